@@ -15,6 +15,7 @@ import (
 	"time"
 
 	du "github.com/elankath/machine-controller-manager-provider-virtual/pkg/devutil"
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -47,6 +48,8 @@ const (
 	ExitStopMCM
 	ExitStatusCheck
 	ExitUnsupported
+	ExitGenerateKubeletConfig
+	ExitGenerateMachineImageCatalog
 )
 
 var (
@@ -93,6 +96,7 @@ type SpecPaths struct {
 	CADeploy           string
 	MCMDeploy          string
 	CAPriorityExpander string
+	Cluster            string
 }
 
 type ConfigPaths struct {
@@ -100,6 +104,8 @@ type ConfigPaths struct {
 	LocalKubeConfig string
 	EnvScript       string
 	SetupConfig     string
+	KubeletConfig   string
+	MachineImages   string
 }
 
 var Dirs ProjectDirs
@@ -144,6 +150,7 @@ func init() {
 		CADeploy:           path.Join(Dirs.Spec, "cluster-autoscaler.yaml"),
 		MCMDeploy:          path.Join(Dirs.Spec, "machine-controller-manager.yaml"),
 		CAPriorityExpander: path.Join(Dirs.Spec, "cluster-autoscaler-priority-expander.yaml"),
+		Cluster:            path.Join(Dirs.Spec, "cluster.yaml"),
 	}
 	Logs = LogPaths{
 		KVCL: "/tmp/kvcl.log",
@@ -162,6 +169,8 @@ func init() {
 		LocalKubeConfig: "/tmp/kvcl.yaml",
 		EnvScript:       path.Join(Dirs.Gen, "env"),
 		SetupConfig:     path.Join(Dirs.Gen, "setup-config.json"),
+		KubeletConfig:   path.Join(Dirs.Gen, "kubelet-config.json"),
+		MachineImages:   path.Join(Dirs.Gen, "machine-images.json"),
 	}
 }
 
@@ -310,6 +319,18 @@ func Setup(ctx context.Context) (exitCode int, err error) {
 		exitCode = ExitGenerateSetupConfig
 		return
 	}
+
+	err = GenerateKubeletConfig()
+	if err != nil {
+		exitCode = ExitGenerateKubeletConfig
+		return
+	}
+
+	err = GenerateMachineImageCatalog()
+	if err != nil {
+		exitCode = ExitGenerateMachineImageCatalog
+		return
+	}
 	return
 }
 
@@ -752,6 +773,15 @@ func DownloadClusterData(ctx context.Context, coord du.ClusterCoordinate) (clust
 		return
 	}
 	klog.Infof("shootNamespace: %q", shootNamespace)
+	if !du.Exists(Specs.Cluster) {
+		_, err = gctl.ExecuteCommandOnPlane(ctx, du.ControlPlane, fmt.Sprintf("kubectl get cluster %s -oyaml > %s", shootNamespace, Specs.Cluster))
+		if err != nil {
+			return
+		}
+		klog.Infof("Downloaded Cluster YAML into %q.", Specs.Cluster)
+	} else {
+		klog.Infof("Cluster YAML already present at %q - skipping download.", Specs.Cluster)
+	}
 	scrtList, err := controlKubeClient.CoreV1().Secrets(shootNamespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return
@@ -939,6 +969,95 @@ func GenerateSetupConfig(so SetupOpts) (err error) {
 	return
 }
 
+// GenerateKubeletConfig extracts the kubernetes version and kubelet reservations of the shoot and its worker pools
+// from the downloaded Cluster into 'gen/kubelet-config.json' which is used by the virtual machine-controller to compute
+// node allocatable and node info.
+func GenerateKubeletConfig() (err error) {
+	shootKubernetes, poolKubernetes, err := du.LoadShootKubernetes(Specs.Cluster)
+	if err != nil {
+		return fmt.Errorf("cannot load kubelet configs from %q: %w", Specs.Cluster, err)
+	}
+	kc := virtual.KubeletConfig{
+		Default:      toKubeletReservation(shootKubernetes.Kubelet),
+		Pools:        make(map[string]virtual.KubeletReservation),
+		Version:      shootKubernetes.Version,
+		PoolVersions: make(map[string]string),
+	}
+	for poolName, k := range poolKubernetes {
+		if k.Kubelet != nil {
+			kc.Pools[poolName] = toKubeletReservation(k.Kubelet)
+		}
+		if k.Version != "" {
+			kc.PoolVersions[poolName] = k.Version
+		}
+	}
+	err = du.WriteJson(Configs.KubeletConfig, kc)
+	if err != nil {
+		return
+	}
+	klog.Infof("Generated KubeletConfig JSON at %q", Configs.KubeletConfig)
+	return
+}
+
+// GenerateMachineImageCatalog extracts the machine images and their AMIs from the downloaded Workers into
+// 'gen/machine-images.json' which is used by the virtual machine-controller to populate the node info.
+func GenerateMachineImageCatalog() (err error) {
+	workerImages, err := du.LoadWorkerMachineImages(Specs.Worker)
+	if err != nil {
+		return fmt.Errorf("cannot load machine images from %q: %w", Specs.Worker, err)
+	}
+	images := make([]virtual.MachineImage, 0, len(workerImages))
+	for _, wi := range workerImages {
+		images = append(images, virtual.MachineImage{
+			AMI:          wi.AMI,
+			Name:         wi.Name,
+			Version:      wi.Version,
+			Architecture: wi.Architecture,
+		})
+	}
+	err = du.WriteJson(Configs.MachineImages, images)
+	if err != nil {
+		return
+	}
+	klog.Infof("Generated machine image catalog JSON at %q", Configs.MachineImages)
+	return
+}
+
+func toKubeletReservation(kubelet *du.ShootKubeletConfig) (r virtual.KubeletReservation) {
+	if kubelet == nil {
+		return
+	}
+	r.KubeReserved = toResourceList(kubelet.KubeReserved)
+	r.SystemReserved = toResourceList(kubelet.SystemReserved)
+	if e := kubelet.EvictionHard; e != nil {
+		r.EvictionHard = make(map[string]string)
+		if e.MemoryAvailable != nil {
+			r.EvictionHard[virtual.EvictionSignalMemoryAvailable] = *e.MemoryAvailable
+		}
+		if e.NodeFSAvailable != nil {
+			r.EvictionHard[virtual.EvictionSignalNodeFSAvailable] = *e.NodeFSAvailable
+		}
+	}
+	return
+}
+
+func toResourceList(reserved *du.ShootKubeletReserved) corev1.ResourceList {
+	if reserved == nil {
+		return nil
+	}
+	resources := make(corev1.ResourceList)
+	if reserved.CPU != nil {
+		resources[corev1.ResourceCPU] = *reserved.CPU
+	}
+	if reserved.Memory != nil {
+		resources[corev1.ResourceMemory] = *reserved.Memory
+	}
+	if reserved.EphemeralStorage != nil {
+		resources[corev1.ResourceEphemeralStorage] = *reserved.EphemeralStorage
+	}
+	return resources
+}
+
 func replaceKubeConfigOptions(args []string) {
 	for i, arg := range args {
 		if strings.HasPrefix(arg, "--kubeconfig=") {
@@ -43,24 +43,33 @@ func main() {
 
 	s := options.NewMCServer()
 	s.AddFlags(pflag.CommandLine)
+	adminAddress := pflag.CommandLine.String("virtual-admin-address", virtual.DefaultAdminAddress, "Address of the admin HTTP API of the virtual provider. Disabled if empty.")
 
 	flag.InitFlags()
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
 	if s.TargetKubeconfig == "" {
-		fmt.Errorf("--target-kubeconfig must be provided")
+		fmt.Fprintln(os.Stderr, "--target-kubeconfig must be provided")
 		os.Exit(1)
 	}
 	if s.Namespace == "" {
-		fmt.Errorf("--namespace must be provided")
+		fmt.Fprintln(os.Stderr, "--namespace must be provided")
 		os.Exit(2)
 	}
-	driver, err := virtual.NewDriver(context.Background(), s.TargetKubeconfig, s.Namespace)
+	ctx := context.Background()
+	driver, err := virtual.NewDriver(ctx, s.TargetKubeconfig, s.Namespace)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(2)
 	}
+	if d, ok := driver.(*virtual.DriverImpl); ok && *adminAddress != "" {
+		go func() {
+			if err := d.ServeAdmin(ctx, *adminAddress); err != nil {
+				fmt.Fprintf(os.Stderr, "admin API failed: %v\n", err)
+			}
+		}()
+	}
 
 	if err := app.Run(s, driver); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
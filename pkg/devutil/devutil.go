@@ -426,7 +426,7 @@ func LaunchBackgroundCommand(cmd *exec.Cmd, logPath string, pidPath string) erro
 	pid := cmd.Process.Pid
 	err = os.WriteFile(pidPath, []byte(strconv.Itoa(pid)), 0666)
 	if err != nil {
-		return fmt.Errorf("cannot write pid to pidPath %q: %w", pid, err)
+		return fmt.Errorf("cannot write pid %d to pidPath %q: %w", pid, pidPath, err)
 	}
 	klog.Infof("LaunchCommand: Started %q with pid: %d, logging to: %q", cmd, pid, logPath)
 	return nil
@@ -447,7 +447,7 @@ func LaunchCommand(cmd *exec.Cmd, logPath string, pidPath string, cancel context
 	pid := cmd.Process.Pid
 	err = os.WriteFile(pidPath, []byte(strconv.Itoa(pid)), 0666)
 	if err != nil {
-		return fmt.Errorf("cannot write pid to pidPath %q: %w", pid, err)
+		return fmt.Errorf("cannot write pid %d to pidPath %q: %w", pid, pidPath, err)
 	}
 	klog.Infof("LaunchCommand: Started %q with pid: %d, logging to: %q", cmd, pid, logPath)
 	go func() {
@@ -688,7 +688,7 @@ func CreateUpdateDummyApp(ctx context.Context, client kubernetes.Interface, shoo
 	deployment.Status.AvailableReplicas = int32(numReplicas)
 	deployment, err = deploymentClient.UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("dev cannot update replicas to %q for dummy machine-controller-manager deployment: %w", numReplicas, err)
+		return fmt.Errorf("dev cannot update replicas to %d for dummy machine-controller-manager deployment: %w", numReplicas, err)
 	}
 	klog.Infof("dev successfully updated replicas, availableReplicas of dummy machine-controller-manager to %d", numReplicas)
 	return nil
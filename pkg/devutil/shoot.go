@@ -0,0 +1,120 @@
+package devutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ShootKubeletConfig is the subset of the gardener KubeletConfig of a shoot relevant for resource reservation.
+type ShootKubeletConfig struct {
+	KubeReserved   *ShootKubeletReserved `json:"kubeReserved,omitempty"`
+	SystemReserved *ShootKubeletReserved `json:"systemReserved,omitempty"`
+	EvictionHard   *ShootKubeletEviction `json:"evictionHard,omitempty"`
+}
+
+// ShootKubeletReserved mirrors the gardener KubeletConfigReserved.
+type ShootKubeletReserved struct {
+	CPU              *resource.Quantity `json:"cpu,omitempty"`
+	Memory           *resource.Quantity `json:"memory,omitempty"`
+	EphemeralStorage *resource.Quantity `json:"ephemeralStorage,omitempty"`
+	PID              *resource.Quantity `json:"pid,omitempty"`
+}
+
+// ShootKubeletEviction mirrors the gardener KubeletConfigEviction.
+type ShootKubeletEviction struct {
+	MemoryAvailable   *string `json:"memoryAvailable,omitempty"`
+	ImageFSAvailable  *string `json:"imageFSAvailable,omitempty"`
+	ImageFSInodesFree *string `json:"imageFSInodesFree,omitempty"`
+	NodeFSAvailable   *string `json:"nodeFSAvailable,omitempty"`
+	NodeFSInodesFree  *string `json:"nodeFSInodesFree,omitempty"`
+}
+
+// ShootKubernetes is the subset of the gardener Kubernetes settings of a shoot or one of its worker pools.
+type ShootKubernetes struct {
+	Version string              `json:"version,omitempty"`
+	Kubelet *ShootKubeletConfig `json:"kubelet,omitempty"`
+}
+
+// shootCluster is the subset of the extensions.gardener.cloud Cluster resource in the shoot namespace of the seed that
+// is needed to extract the kubelet configuration of the shoot and its worker pools.
+type shootCluster struct {
+	Spec struct {
+		Shoot struct {
+			Spec struct {
+				Kubernetes ShootKubernetes `json:"kubernetes"`
+				Provider   struct {
+					Workers []struct {
+						Name       string           `json:"name"`
+						Kubernetes *ShootKubernetes `json:"kubernetes,omitempty"`
+					} `json:"workers"`
+				} `json:"provider"`
+			} `json:"spec"`
+		} `json:"shoot"`
+	} `json:"spec"`
+}
+
+// LoadShootKubernetes loads the Cluster YAML at the given path and returns the kubernetes settings of the shoot along
+// with the kubernetes settings of worker pools that specify any.
+func LoadShootKubernetes(clusterYAMLPath string) (shootKubernetes ShootKubernetes, poolKubernetes map[string]ShootKubernetes, err error) {
+	data, err := os.ReadFile(clusterYAMLPath)
+	if err != nil {
+		return
+	}
+	var cluster shootCluster
+	err = yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&cluster)
+	if err != nil {
+		err = fmt.Errorf("cannot decode cluster %q: %w", clusterYAMLPath, err)
+		return
+	}
+	shootSpec := cluster.Spec.Shoot.Spec
+	shootKubernetes = shootSpec.Kubernetes
+	poolKubernetes = make(map[string]ShootKubernetes)
+	for _, w := range shootSpec.Provider.Workers {
+		if w.Kubernetes != nil {
+			poolKubernetes[w.Name] = *w.Kubernetes
+		}
+	}
+	return
+}
+
+// WorkerMachineImage is a machine image entry of the provider status of an AWS Worker.
+type WorkerMachineImage struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	AMI          string `json:"ami"`
+	Architecture string `json:"architecture,omitempty"`
+}
+
+// workerList is the subset of a list of extensions.gardener.cloud Workers needed to extract their machine images.
+type workerList struct {
+	Items []struct {
+		Status struct {
+			ProviderStatus struct {
+				MachineImages []WorkerMachineImage `json:"machineImages"`
+			} `json:"providerStatus"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// LoadWorkerMachineImages loads the Worker list YAML at the given path and returns the machine images along with
+// their AMIs from the provider status of the Workers.
+func LoadWorkerMachineImages(workerYAMLPath string) (images []WorkerMachineImage, err error) {
+	data, err := os.ReadFile(workerYAMLPath)
+	if err != nil {
+		return
+	}
+	var workers workerList
+	err = yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&workers)
+	if err != nil {
+		err = fmt.Errorf("cannot decode workers %q: %w", workerYAMLPath, err)
+		return
+	}
+	for _, w := range workers.Items {
+		images = append(images, w.Status.ProviderStatus.MachineImages...)
+	}
+	return
+}
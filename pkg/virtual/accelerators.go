@@ -0,0 +1,181 @@
+package virtual
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// ResourceGPU is the NodeTemplate capacity key used by gardener for the number of GPUs of a machine type.
+	ResourceGPU corev1.ResourceName = "gpu"
+
+	ResourceNvidiaGPU corev1.ResourceName = "nvidia.com/gpu"
+	ResourceAMDGPU    corev1.ResourceName = "amd.com/gpu"
+	ResourceIntelGPU  corev1.ResourceName = "gpu.intel.com/i915"
+	ResourceGaudi     corev1.ResourceName = "habana.ai/gaudi"
+
+	GPUManufacturerNvidia = "NVIDIA"
+	GPUManufacturerAMD    = "AMD"
+	GPUManufacturerIntel  = "Intel"
+	GPUManufacturerHabana = "Habana"
+
+	// LabelAccelerator is the AWS node label holding the accelerator model, which the cluster-autoscaler uses to
+	// detect GPU nodes.
+	LabelAccelerator = "k8s.amazonaws.com/accelerator"
+
+	LabelNvidiaGPUPresent = "nvidia.com/gpu.present"
+	LabelNvidiaGPUCount   = "nvidia.com/gpu.count"
+	LabelNvidiaGPUProduct = "nvidia.com/gpu.product"
+	LabelNvidiaGPUMemory  = "nvidia.com/gpu.memory"
+	// LabelNvidiaMIGConfig is the label used by the NVIDIA MIG manager to partition all GPUs of a node, eg: all-1g.5gb
+	LabelNvidiaMIGConfig = "nvidia.com/mig.config"
+	// LabelNvidiaMIGStrategy is either 'single' (MIG devices exposed as nvidia.com/gpu) or 'mixed' (MIG devices
+	// exposed as nvidia.com/mig-<profile>). Defaults to 'mixed'.
+	LabelNvidiaMIGStrategy = "nvidia.com/mig.strategy"
+
+	LabelAMDGPUFamily  = "amd.com/gpu.family"
+	LabelAMDGPUProduct = "amd.com/gpu.product-name"
+	LabelAMDGPUVRAM    = "amd.com/gpu.vram"
+
+	LabelIntelGPU = "intel.feature.node.kubernetes.io/gpu"
+
+	MIGStrategySingle = "single"
+	MIGStrategyMixed  = "mixed"
+)
+
+// migSlicesPerGPU holds the number of MIG devices a single GPU is partitioned into for the MIG profiles supported by
+// the A100 and H100 GPUs.
+var migSlicesPerGPU = map[string]int64{
+	"1g.5gb":  7,
+	"1g.10gb": 7,
+	"1g.20gb": 4,
+	"2g.10gb": 3,
+	"2g.20gb": 3,
+	"3g.20gb": 2,
+	"3g.40gb": 2,
+	"4g.20gb": 1,
+	"4g.40gb": 1,
+	"7g.40gb": 1,
+	"7g.80gb": 1,
+}
+
+// GPUResourceName returns the extended resource name advertised by the device plugin of the given GPU manufacturer.
+// Unknown manufacturers are assumed to be NVIDIA.
+func GPUResourceName(manufacturer string) corev1.ResourceName {
+	switch manufacturer {
+	case GPUManufacturerAMD:
+		return ResourceAMDGPU
+	case GPUManufacturerIntel:
+		return ResourceIntelGPU
+	case GPUManufacturerHabana:
+		return ResourceGaudi
+	default:
+		return ResourceNvidiaGPU
+	}
+}
+
+// applyExtendedResources replaces the gardener specific gpu capacity of the node with the extended resource of the
+// device plugin of the GPU manufacturer, copies the extended and virtual capacity of the NodeTemplate, drops
+// zero-capacity extended resources and sets the accelerator labels a real node would carry.
+func applyExtendedResources(node *corev1.Node, nodeTemplate v1alpha1.NodeTemplate, it InstanceType) error {
+	capacity := node.Status.Capacity
+	maps.Copy(capacity, nodeTemplate.VirtualCapacity)
+	gpuCount := capacity[ResourceGPU]
+	delete(capacity, ResourceGPU)
+	for name, quantity := range capacity {
+		if isExtendedResourceName(name) && quantity.IsZero() {
+			delete(capacity, name)
+		}
+	}
+	if gpuCount.IsZero() {
+		return nil
+	}
+	resourceName := GPUResourceName(it.GPUManufacturer)
+	if _, ok := capacity[resourceName]; !ok {
+		capacity[resourceName] = gpuCount
+	}
+	numGPUs := gpuCount.Value()
+	if it.GPUModel != "" {
+		node.Labels[LabelAccelerator] = sanitizeLabelValue(it.GPUModel)
+	}
+	switch resourceName {
+	case ResourceNvidiaGPU:
+		node.Labels[LabelNvidiaGPUPresent] = "true"
+		node.Labels[LabelNvidiaGPUCount] = strconv.FormatInt(numGPUs, 10)
+		if it.GPUModel != "" {
+			node.Labels[LabelNvidiaGPUProduct] = sanitizeLabelValue(it.GPUModel)
+		}
+		if it.GPUMemoryMiB > 0 {
+			node.Labels[LabelNvidiaGPUMemory] = strconv.FormatInt(it.GPUMemoryMiB, 10)
+		}
+		return applyMIGProfile(node, numGPUs)
+	case ResourceAMDGPU:
+		if it.GPUFamily != "" {
+			node.Labels[LabelAMDGPUFamily] = it.GPUFamily
+		}
+		if it.GPUModel != "" {
+			node.Labels[LabelAMDGPUProduct] = sanitizeLabelValue(it.GPUModel)
+		}
+		if it.GPUMemoryMiB > 0 {
+			node.Labels[LabelAMDGPUVRAM] = fmt.Sprintf("%dG", it.GPUMemoryMiB/1024)
+		}
+	case ResourceIntelGPU:
+		node.Labels[LabelIntelGPU] = "true"
+	}
+	return nil
+}
+
+// applyMIGProfile partitions the NVIDIA GPUs of the node as per the all-<profile> MIG configuration label of the node.
+func applyMIGProfile(node *corev1.Node, numGPUs int64) error {
+	migConfig, ok := node.Labels[LabelNvidiaMIGConfig]
+	if !ok || migConfig == "all-disabled" {
+		return nil
+	}
+	profile, ok := strings.CutPrefix(migConfig, "all-")
+	if !ok {
+		return fmt.Errorf("unsupported MIG config %q for node %q - only all-<profile> is supported", migConfig, node.Name)
+	}
+	numSlices, ok := migSlicesPerGPU[profile]
+	if !ok {
+		return fmt.Errorf("unknown MIG profile %q for node %q", profile, node.Name)
+	}
+	numMIGDevices := *resource.NewQuantity(numGPUs*numSlices, resource.DecimalSI)
+	strategy := cmp.Or(node.Labels[LabelNvidiaMIGStrategy], MIGStrategyMixed)
+	switch strategy {
+	case MIGStrategySingle:
+		node.Status.Capacity[ResourceNvidiaGPU] = numMIGDevices
+		if product, ok := node.Labels[LabelNvidiaGPUProduct]; ok {
+			node.Labels[LabelNvidiaGPUProduct] = product + "-MIG-" + profile
+		}
+	case MIGStrategyMixed:
+		delete(node.Status.Capacity, ResourceNvidiaGPU)
+		node.Status.Capacity[corev1.ResourceName("nvidia.com/mig-"+profile)] = numMIGDevices
+	default:
+		return fmt.Errorf("unknown MIG strategy %q for node %q", strategy, node.Name)
+	}
+	node.Labels[LabelNvidiaMIGStrategy] = strategy
+	return nil
+}
+
+func isExtendedResourceName(name corev1.ResourceName) bool {
+	return strings.Contains(string(name), "/") && !strings.HasPrefix(string(name), corev1.ResourceDefaultNamespacePrefix)
+}
+
+// sanitizeLabelValue replaces the characters not permitted in label values the way the GPU feature discovery does.
+func sanitizeLabelValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, value)
+}
@@ -0,0 +1,94 @@
+package virtual
+
+import (
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyExtendedResources(t *testing.T) {
+	catalog, err := LoadInstanceTypeCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name             string
+		instanceType     string
+		labels           map[string]string
+		expectedCapacity map[corev1.ResourceName]int64
+		absentCapacity   []corev1.ResourceName
+		expectedLabels   map[string]string
+	}{
+		{
+			name:             "non-gpu instance has no gpu keys",
+			instanceType:     "m5.large",
+			absentCapacity:   []corev1.ResourceName{ResourceGPU, ResourceNvidiaGPU},
+			expectedCapacity: map[corev1.ResourceName]int64{corev1.ResourceCPU: 2},
+		},
+		{
+			name:             "nvidia gpu",
+			instanceType:     "g4dn.xlarge",
+			absentCapacity:   []corev1.ResourceName{ResourceGPU},
+			expectedCapacity: map[corev1.ResourceName]int64{ResourceNvidiaGPU: 1},
+			expectedLabels:   map[string]string{LabelNvidiaGPUPresent: "true", LabelNvidiaGPUProduct: "Tesla-T4", LabelAccelerator: "Tesla-T4"},
+		},
+		{
+			name:             "amd gpu",
+			instanceType:     "g4ad.xlarge",
+			absentCapacity:   []corev1.ResourceName{ResourceNvidiaGPU},
+			expectedCapacity: map[corev1.ResourceName]int64{ResourceAMDGPU: 1},
+			expectedLabels:   map[string]string{LabelAMDGPUFamily: "NV", LabelAMDGPUProduct: "Radeon-Pro-V520"},
+		},
+		{
+			name:             "mig mixed strategy",
+			instanceType:     "p4d.24xlarge",
+			labels:           map[string]string{LabelNvidiaMIGConfig: "all-1g.5gb"},
+			absentCapacity:   []corev1.ResourceName{ResourceNvidiaGPU},
+			expectedCapacity: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.5gb": 56},
+			expectedLabels:   map[string]string{LabelNvidiaMIGStrategy: MIGStrategyMixed},
+		},
+		{
+			name:             "mig single strategy",
+			instanceType:     "p4d.24xlarge",
+			labels:           map[string]string{LabelNvidiaMIGConfig: "all-3g.20gb", LabelNvidiaMIGStrategy: MIGStrategySingle},
+			expectedCapacity: map[corev1.ResourceName]int64{ResourceNvidiaGPU: 16},
+			expectedLabels:   map[string]string{LabelNvidiaGPUProduct: "NVIDIA-A100-SXM4-40GB-MIG-3g.20gb"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			machineClass := &v1alpha1.MachineClass{NodeTemplate: &v1alpha1.NodeTemplate{InstanceType: tc.instanceType, Region: "eu-west-1"}}
+			nt, err := catalog.ResolveNodeTemplate(machineClass)
+			if err != nil {
+				t.Fatal(err)
+			}
+			machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "m1"}}
+			machine.Spec.NodeTemplateSpec.Labels = tc.labels
+			node, err := newNode(machine, nt, catalog[tc.instanceType], KubeletReservation{}, KubeletUserData{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range tc.expectedCapacity {
+				if got := node.Status.Capacity[name]; got.Cmp(*resource.NewQuantity(expected, resource.DecimalSI)) != 0 {
+					t.Errorf("expected capacity %s=%d, got %s", name, expected, got.String())
+				}
+				if _, ok := node.Status.Allocatable[name]; !ok {
+					t.Errorf("expected allocatable %s", name)
+				}
+			}
+			for _, name := range tc.absentCapacity {
+				if q, ok := node.Status.Capacity[name]; ok {
+					t.Errorf("expected no capacity %s, got %s", name, q.String())
+				}
+			}
+			for k, v := range tc.expectedLabels {
+				if node.Labels[k] != v {
+					t.Errorf("expected label %s=%q, got %q", k, v, node.Labels[k])
+				}
+			}
+		})
+	}
+}
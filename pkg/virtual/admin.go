@@ -0,0 +1,342 @@
+package virtual
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultAdminAddress is the local address the admin API of the virtual machine-controller listens on by default.
+const DefaultAdminAddress = "127.0.0.1:10270"
+
+// Instance is a virtual instance as listed by the admin API.
+type Instance struct {
+	MachineName  string
+	NodeName     string
+	ProviderID   string
+	InstanceType string `json:",omitempty"`
+	Zone         string `json:",omitempty"`
+	State        InstanceState
+	// Joined is false for instances simulated to never register their node.
+	Joined     bool
+	Conditions []corev1.NodeCondition `json:",omitempty"`
+}
+
+// InstanceEventRequest requests an instance event of the given Type via the admin API.
+type InstanceEventRequest struct {
+	Type string
+}
+
+// errBadRequest is returned for admin API requests that cannot be decoded.
+var errBadRequest = errors.New("bad request")
+
+// AdminHandler returns the handler of the admin API, which lists the virtual instances, changes the SimulationConfig,
+// triggers instance events and forces node conditions. Changes take effect immediately.
+//
+//	GET  /instances                                list the instances
+//	GET  /instances/{machine}                      get the instance of a machine
+//	POST /instances/{machine}/events               trigger an instance event, eg: {"Type":"reboot"}
+//	PUT  /instances/{machine}/conditions/{type}    force a node condition, eg: {"Status":"False","Reason":"KubeletDown"}
+//	GET  /simulation-config                        get the effective SimulationConfig
+//	PUT  /simulation-config                        replace the SimulationConfig with the YAML or JSON body
+//	PUT  /simulation-config/quotas                 replace the Quotas including those synced from the MachineClasses
+//	PUT  /simulation-config/instance-delays        replace the InstanceDelays
+func (d *DriverImpl) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /instances", func(w http.ResponseWriter, r *http.Request) {
+		instances, err := d.Instances(r.Context())
+		writeAdminResponse(w, instances, err)
+	})
+	mux.HandleFunc("GET /instances/{machine}", func(w http.ResponseWriter, r *http.Request) {
+		instance, err := d.instance(r.Context(), r.PathValue("machine"))
+		writeAdminResponse(w, instance, err)
+	})
+	mux.HandleFunc("POST /instances/{machine}/events", func(w http.ResponseWriter, r *http.Request) {
+		var req InstanceEventRequest
+		err := decodeAdminRequest(r, &req)
+		if err == nil {
+			err = d.TriggerInstanceEvent(r.Context(), r.PathValue("machine"), req.Type)
+		}
+		writeAdminResponse(w, nil, err)
+	})
+	mux.HandleFunc("PUT /instances/{machine}/conditions/{type}", func(w http.ResponseWriter, r *http.Request) {
+		var condition corev1.NodeCondition
+		err := decodeAdminRequest(r, &condition)
+		if err == nil {
+			condition.Type = corev1.NodeConditionType(r.PathValue("type"))
+			err = d.ForceNodeCondition(r.Context(), r.PathValue("machine"), condition)
+		}
+		writeAdminResponse(w, nil, err)
+	})
+	mux.HandleFunc("GET /simulation-config", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		simConfig := d.simConfig
+		d.mu.Unlock()
+		writeAdminResponse(w, simConfig, nil)
+	})
+	mux.HandleFunc("PUT /simulation-config", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeAdminResponse(w, nil, fmt.Errorf("%w: %w", errBadRequest, err))
+			return
+		}
+		decoded, err := DecodeSimulationConfig(data)
+		var simConfig SimulationConfig
+		if err == nil {
+			simConfig, err = d.UpdateSimulationConfig(r.Context(), func(s *SimulationConfig) { *s = decoded })
+		}
+		writeAdminResponse(w, simConfig, err)
+	})
+	mux.HandleFunc("PUT /simulation-config/quotas", func(w http.ResponseWriter, r *http.Request) {
+		var quotas []Quota
+		err := decodeAdminRequest(r, &quotas)
+		var simConfig SimulationConfig
+		if err == nil {
+			simConfig, err = d.ReplaceQuotas(r.Context(), quotas)
+		}
+		writeAdminResponse(w, simConfig.Quotas, err)
+	})
+	mux.HandleFunc("PUT /simulation-config/instance-delays", func(w http.ResponseWriter, r *http.Request) {
+		var delays InstanceDelays
+		err := decodeAdminRequest(r, &delays)
+		var simConfig SimulationConfig
+		if err == nil {
+			simConfig, err = d.UpdateSimulationConfig(r.Context(), func(s *SimulationConfig) { s.InstanceDelays = delays })
+		}
+		writeAdminResponse(w, simConfig.InstanceDelays, err)
+	})
+	return mux
+}
+
+// ServeAdmin serves the AdminHandler on the given address until the context is done.
+func (d *DriverImpl) ServeAdmin(ctx context.Context, address string) error {
+	server := &http.Server{Addr: address, Handler: d.AdminHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	klog.Infof("Serving admin API on %q", address)
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func decodeAdminRequest(r *http.Request, v any) error {
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = yaml.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBadRequest, err)
+	}
+	return nil
+}
+
+func writeAdminResponse(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInstanceNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, errBadRequest), errors.Is(err, ErrInvalidSimulationConfig):
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("Cannot write admin API response: %v", err)
+	}
+}
+
+// Instances returns the virtual instances sorted by machine name.
+func (d *DriverImpl) Instances(ctx context.Context) (instances []Instance, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.reloadNodes(ctx)
+	if err != nil {
+		return
+	}
+	instances = []Instance{}
+	for _, node := range d.managedNodes {
+		instances = append(instances, d.instanceOf(node))
+	}
+	slices.SortFunc(instances, func(a, b Instance) int {
+		return cmp.Compare(a.MachineName, b.MachineName)
+	})
+	return
+}
+
+func (d *DriverImpl) instance(ctx context.Context, machineName string) (instance Instance, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.reloadNodes(ctx)
+	if err != nil {
+		return
+	}
+	node, ok := d.nodeForMachine(machineName)
+	if !ok {
+		err = fmt.Errorf("%w: machine %q", ErrInstanceNotFound, machineName)
+		return
+	}
+	instance = d.instanceOf(node)
+	return
+}
+
+func (d *DriverImpl) instanceOf(node corev1.Node) Instance {
+	_, unjoined := d.unjoinedInstances[node.Name]
+	node = initialized(node)
+	return Instance{
+		MachineName:  machineNameOf(node),
+		NodeName:     node.Name,
+		ProviderID:   node.Spec.ProviderID,
+		InstanceType: node.Labels[corev1.LabelInstanceTypeStable],
+		Zone:         node.Labels[corev1.LabelTopologyZone],
+		State:        instanceStateOf(node),
+		Joined:       !unjoined,
+		Conditions:   node.Status.Conditions,
+	}
+}
+
+// ForceNodeCondition sets the given condition on the node of the instance of the given machine, replacing the
+// condition of the same type.
+func (d *DriverImpl) ForceNodeCondition(ctx context.Context, machineName string, condition corev1.NodeCondition) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, ok := d.nodeForMachine(machineName)
+	if !ok {
+		return fmt.Errorf("%w: machine %q", ErrInstanceNotFound, machineName)
+	}
+	if _, unjoined := d.unjoinedInstances[node.Name]; unjoined {
+		return fmt.Errorf("%w: instance of machine %q has no node", errBadRequest, machineName)
+	}
+	if condition.Type == "" || condition.Status == "" {
+		return fmt.Errorf("%w: condition type and status are required", errBadRequest)
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		n, err := d.client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		forced := condition
+		forced.LastHeartbeatTime = now
+		forced.LastTransitionTime = now
+		idx := slices.IndexFunc(n.Status.Conditions, func(c corev1.NodeCondition) bool { return c.Type == condition.Type })
+		if idx < 0 {
+			n.Status.Conditions = append(n.Status.Conditions, forced)
+		} else {
+			if n.Status.Conditions[idx].Status == forced.Status {
+				forced.LastTransitionTime = n.Status.Conditions[idx].LastTransitionTime
+			}
+			n.Status.Conditions[idx] = forced
+		}
+		n, err = d.client.CoreV1().Nodes().UpdateStatus(ctx, n, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		d.managedNodes[n.Name] = *n
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot force condition %s=%s on node %q: %w", condition.Type, condition.Status, node.Name, err)
+	}
+	klog.Infof("Forced condition %s=%s on node %q", condition.Type, condition.Status, node.Name)
+	return nil
+}
+
+// UpdateSimulationConfig changes the SimulationConfig of the SimulationConfig ConfigMap with the given mutate func and
+// applies it right away, returning the effective SimulationConfig. The ConfigMap is rewritten as YAML under the
+// SimulationConfigYAMLKey, which drops its comments. An invalid result is rejected and leaves the ConfigMap unchanged.
+func (d *DriverImpl) UpdateSimulationConfig(ctx context.Context, mutate func(s *SimulationConfig)) (simConfig SimulationConfig, err error) {
+	return d.updateSimulationConfigMap(ctx, mutate, nil)
+}
+
+// ReplaceQuotas makes the given quotas the Quotas of the SimulationConfig and the quotas synced from the MachineClasses
+// and applies them right away, so that quotas missing from the given ones are removed. Quotas of instance types and
+// regions still used by MachineClasses are synced anew on the next MachineClass change unless QuotaSync is disabled.
+func (d *DriverImpl) ReplaceQuotas(ctx context.Context, quotas []Quota) (simConfig SimulationConfig, err error) {
+	return d.updateSimulationConfigMap(ctx, func(s *SimulationConfig) { s.Quotas = quotas }, func(cm *corev1.ConfigMap) error {
+		if _, ok := cm.Data[SimulationConfigQuotasKey]; !ok {
+			return nil
+		}
+		data, err := yaml.Marshal(quotas)
+		if err != nil {
+			return err
+		}
+		cm.Data[SimulationConfigQuotasKey] = string(data)
+		return nil
+	})
+}
+
+// updateSimulationConfigMap is UpdateSimulationConfig additionally changing the SimulationConfig ConfigMap with the
+// given mutateConfigMap func if set.
+func (d *DriverImpl) updateSimulationConfigMap(ctx context.Context, mutate func(s *SimulationConfig), mutateConfigMap func(cm *corev1.ConfigMap) error) (simConfig SimulationConfig, err error) {
+	var updated *corev1.ConfigMap
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := d.client.CoreV1().ConfigMaps(d.shootNamespace).Get(ctx, SimulationConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		data, ok := cm.Data[SimulationConfigYAMLKey]
+		if !ok {
+			data = cm.Data[SimulationConfigKey]
+		}
+		s, err := DecodeSimulationConfig([]byte(data))
+		if err != nil {
+			return err
+		}
+		mutate(&s)
+		yamlData, err := yaml.Marshal(s)
+		if err != nil {
+			return err
+		}
+		cm = cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[SimulationConfigYAMLKey] = string(yamlData)
+		delete(cm.Data, SimulationConfigKey)
+		if mutateConfigMap != nil {
+			if err = mutateConfigMap(cm); err != nil {
+				return err
+			}
+		}
+		if _, err = simulationConfigOf(cm); err != nil {
+			return err
+		}
+		updated, err = d.client.CoreV1().ConfigMaps(d.shootNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("cannot update SimulationConfig: %w", err)
+		return
+	}
+	err = d.applySimulationConfigMap(updated)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	simConfig = d.simConfig
+	d.mu.Unlock()
+	return
+}
@@ -0,0 +1,121 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1", Labels: map[string]string{LabelMachineName: "m1", corev1.LabelInstanceTypeStable: "m5.large"}},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///eu-west-1a/i-1"},
+		Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionTrue)},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: SimulationConfigMapName, Namespace: "shoot--p--s"},
+		Data: map[string]string{
+			SimulationConfigKey:       `{"apiVersion":"virtual.gardener.cloud/v1alpha1","InstanceDelays":{"CreateMin":1,"CreateMax":2}}`,
+			SimulationConfigQuotasKey: "- {MachineType: m5.large, Region: eu-west-1, Amount: 10}\n- {MachineType: c5.large, Region: eu-west-1, Amount: 10}\n",
+		},
+	}
+	client := fake.NewClientset(node, cm)
+	d := &DriverImpl{
+		client:              client,
+		shootNamespace:      "shoot--p--s",
+		managedNodes:        make(map[string]corev1.Node),
+		unjoinedInstances:   make(map[string]corev1.Node),
+		firedInstanceEvents: make(map[string]bool),
+	}
+	server := httptest.NewServer(d.AdminHandler())
+	defer server.Close()
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	var instances []Instance
+	if resp := do(http.MethodGet, "/instances", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /instances status = %d", resp.StatusCode)
+	} else if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].MachineName != "m1" || instances[0].State != InstanceStateRunning || instances[0].InstanceType != "m5.large" {
+		t.Errorf("GET /instances = %+v", instances)
+	}
+	if resp := do(http.MethodGet, "/instances/m2", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /instances/m2 status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	if resp := do(http.MethodPut, "/instances/m1/conditions/MemoryPressure", `{"Status":"True","Reason":"KubeletHasInsufficientMemory"}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT condition status = %d", resp.StatusCode)
+	}
+	updated, err := client.CoreV1().Nodes().Get(ctx, "m1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := conditionOf(updated, corev1.NodeMemoryPressure); c == nil || c.Status != corev1.ConditionTrue || c.Reason != "KubeletHasInsufficientMemory" {
+		t.Errorf("MemoryPressure condition = %+v", c)
+	}
+
+	if resp := do(http.MethodPost, "/instances/m1/events", `{"Type":"stop"}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST event status = %d", resp.StatusCode)
+	}
+	if got := instanceStateOf(d.managedNodes["m1"]); got != InstanceStateStopped {
+		t.Errorf("instance state after stop = %q, want %q", got, InstanceStateStopped)
+	}
+
+	// the synced c5.large quota is removed
+	var quotas []Quota
+	if resp := do(http.MethodPut, "/simulation-config/quotas", `[{"MachineType":"m5.large","Region":"eu-west-1","Amount":3}]`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT quotas status = %d", resp.StatusCode)
+	} else if err = json.NewDecoder(resp.Body).Decode(&quotas); err != nil {
+		t.Fatal(err)
+	}
+	if len(quotas) != 1 || quotas[0].Amount != 3 {
+		t.Errorf("PUT quotas = %v, want only the m5.large quota", quotas)
+	}
+	if len(d.simConfig.Quotas) != 1 || d.simConfig.Quotas[0].Amount != 3 || d.simConfig.InstanceDelays.CreateMax != 2 {
+		t.Errorf("SimulationConfig after PUT quotas = %+v", d.simConfig)
+	}
+	if resp := do(http.MethodPut, "/simulation-config/instance-delays", `{"CreateMin":5,"CreateMax":1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT invalid instance-delays status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	stored, err := client.CoreV1().ConfigMaps(cm.Namespace).Get(ctx, cm.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := simulationConfigOf(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.InstanceDelays.CreateMin != 1 || len(s.Quotas) != 1 {
+		t.Errorf("stored SimulationConfig = %+v", s)
+	}
+}
+
+func conditionOf(node *corev1.Node, conditionType corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == conditionType {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package awsfake
 import (
 	"encoding/json"
 	"fmt"
+
 	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
@@ -16,17 +17,154 @@ type AWSProviderSpec struct {
 	// AMI is the disk image version
 	AMI string `json:"ami,omitempty"`
 
+	// BlockDevices is the list of block devices to be mapped to the EC2 instance
+	BlockDevices []AWSBlockDeviceMappingSpec `json:"blockDevices,omitempty"`
+
+	// CapacityReservationTarget specifies the target of the capacity reservation to launch the instance in
+	CapacityReservationTarget *AWSCapacityReservationTargetSpec `json:"capacityReservation,omitempty"`
+
+	// CPUOptions defines the CPU options for the instance
+	CPUOptions *CPUOptions `json:"cpuOptions,omitempty"`
+
+	// EbsOptimized indicates whether the instance is optimized for Amazon EBS I/O
+	EbsOptimized bool `json:"ebsOptimized,omitempty"`
+
+	// IAM is the IAM instance profile of the instance
+	IAM AWSIAMProfileSpec `json:"iam,omitempty"`
+
+	// InstanceMetadataOptions contains the metadata options for the instance
+	InstanceMetadataOptions *InstanceMetadataOptions `json:"instanceMetadataOptions,omitempty"`
+
 	// MachineType contains the EC2 instance type
 	MachineType string `json:"machineType,omitempty"`
 
+	// KeyName is the name of the key pair to use for the instance
+	KeyName *string `json:"keyName,omitempty"`
+
+	// Monitoring specifies whether detailed monitoring is enabled for the instance
+	Monitoring bool `json:"monitoring,omitempty"`
+
+	// NetworkInterfaces is the list of network interfaces to attach to the instance
+	NetworkInterfaces []AWSNetworkInterfaceSpec `json:"networkInterfaces,omitempty"`
+
 	// Region contains the AWS region for the machine
 	Region string `json:"region,omitempty"`
 
+	// SpotPrice is the maximum price to pay for a spot instance. An empty string means the on-demand price.
+	SpotPrice *string `json:"spotPrice,omitempty"`
+
+	// SrcAndDstChecksEnabled indicates whether source/destination checking is enabled for the instance
+	SrcAndDstChecksEnabled *bool `json:"srcAndDstChecksEnabled,omitempty"`
+
 	// Tags to be specified on the EC2 instances
 	Tags map[string]string `json:"tags,omitempty"`
 }
 
-// DecodeProviderSpecAndSecret converts request parameters to api.ProviderSpec & api.Secrets
+// AWSBlockDeviceMappingSpec describes a block device mapping of an instance.
+type AWSBlockDeviceMappingSpec struct {
+	// DeviceName is the device name (for example, /dev/sdh or xvdh). An empty device name denotes the root device.
+	DeviceName string `json:"deviceName,omitempty"`
+
+	// Ebs contains the parameters used to automatically set up EBS volumes when the instance is launched.
+	Ebs AWSEbsBlockDeviceSpec `json:"ebs,omitempty"`
+
+	// NoDevice suppresses the specified device included in the block device mapping of the AMI.
+	NoDevice string `json:"noDevice,omitempty"`
+
+	// VirtualName is the virtual device name (ephemeralN) of an instance store volume.
+	VirtualName string `json:"virtualName,omitempty"`
+}
+
+// AWSEbsBlockDeviceSpec describes a block device for an EBS volume.
+type AWSEbsBlockDeviceSpec struct {
+	// DeleteOnTermination indicates whether the EBS volume is deleted on instance termination.
+	DeleteOnTermination *bool `json:"deleteOnTermination,omitempty"`
+
+	// Encrypted indicates whether the EBS volume is encrypted.
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// Iops is the number of I/O operations per second that the volume supports.
+	Iops int64 `json:"iops,omitempty"`
+
+	// KmsKeyID is the identifier of the AWS KMS customer master key to use for encryption.
+	KmsKeyID *string `json:"kmsKeyID,omitempty"`
+
+	// SnapshotID is the ID of the snapshot to create the volume from.
+	SnapshotID *string `json:"snapshotID,omitempty"`
+
+	// Throughput is the throughput in MiB/s that the gp3 volume supports.
+	Throughput *int64 `json:"throughput,omitempty"`
+
+	// VolumeSize is the size of the volume, in GiB.
+	VolumeSize int64 `json:"volumeSize,omitempty"`
+
+	// VolumeType is the volume type: gp2, gp3, io1, io2, st1, sc1 or standard.
+	VolumeType string `json:"volumeType,omitempty"`
+}
+
+// AWSCapacityReservationTargetSpec allows to target an AWS capacity reservation directly or indirectly via a
+// capacity reservation group.
+type AWSCapacityReservationTargetSpec struct {
+	// CapacityReservationPreference is either 'open' or 'none'.
+	CapacityReservationPreference *string `json:"capacityReservationPreference,omitempty"`
+
+	// CapacityReservationID is the ID of the capacity reservation to launch the instance in.
+	CapacityReservationID *string `json:"capacityReservationId,omitempty"`
+
+	// CapacityReservationResourceGroupArn is the ARN of the capacity reservation group to launch the instance in.
+	CapacityReservationResourceGroupArn *string `json:"capacityReservationResourceGroupArn,omitempty"`
+}
+
+// AWSIAMProfileSpec describes an IAM instance profile.
+type AWSIAMProfileSpec struct {
+	// ARN is the Amazon Resource Name (ARN) of the instance profile.
+	ARN string `json:"arn,omitempty"`
+
+	// Name is the name of the instance profile.
+	Name string `json:"name,omitempty"`
+}
+
+// AWSNetworkInterfaceSpec describes a network interface.
+type AWSNetworkInterfaceSpec struct {
+	// AssociatePublicIPAddress indicates whether to assign a public IPv4 address to the instance.
+	AssociatePublicIPAddress *bool `json:"associatePublicIPAddress,omitempty"`
+
+	// DeleteOnTermination indicates whether the network interface is deleted on instance termination.
+	DeleteOnTermination *bool `json:"deleteOnTermination,omitempty"`
+
+	// Description of the network interface.
+	Description *string `json:"description,omitempty"`
+
+	// SecurityGroupIDs are the IDs of the security groups for the network interface.
+	SecurityGroupIDs []string `json:"securityGroupIDs,omitempty"`
+
+	// SubnetID is the ID of the subnet associated with the network interface.
+	SubnetID string `json:"subnetID,omitempty"`
+}
+
+// InstanceMetadataOptions describes the metadata options for the instance.
+type InstanceMetadataOptions struct {
+	// HTTPEndpoint enables or disables the HTTP metadata endpoint: 'enabled' or 'disabled'.
+	HTTPEndpoint *string `json:"httpEndpoint,omitempty"`
+
+	// HTTPPutResponseHopLimit is the desired HTTP PUT response hop limit for instance metadata requests.
+	HTTPPutResponseHopLimit *int64 `json:"httpPutResponseHopLimit,omitempty"`
+
+	// HTTPTokens is the state of token usage for instance metadata requests: 'required' or 'optional'.
+	HTTPTokens *string `json:"httpTokens,omitempty"`
+}
+
+// CPUOptions defines the CPU options of the instance.
+type CPUOptions struct {
+	// CoreCount is the number of CPU cores for the instance.
+	CoreCount *int64 `json:"coreCount"`
+
+	// ThreadsPerCore is the number of threads per core: 1 to disable multithreading, 2 otherwise.
+	ThreadsPerCore *int64 `json:"threadsPerCore"`
+}
+
+// DecodeProviderSpecAndSecret converts request parameters to api.ProviderSpec & api.Secrets. A ProviderSpec that
+// cannot be decoded or is empty is an InvalidArgument.
 func DecodeProviderSpecAndSecret(machineClass *v1alpha1.MachineClass) (*AWSProviderSpec, error) {
 	var (
 		providerSpec *AWSProviderSpec
@@ -39,7 +177,10 @@ func DecodeProviderSpecAndSecret(machineClass *v1alpha1.MachineClass) (*AWSProvi
 
 	err := json.Unmarshal(machineClass.ProviderSpec.Raw, &providerSpec)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot decode ProviderSpec of MachineClass %q: %v", machineClass.Name, err))
+	}
+	if providerSpec == nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("ProviderSpec of MachineClass %q is empty", machineClass.Name))
 	}
 
 	return providerSpec, nil
@@ -0,0 +1,225 @@
+package awsfake
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	dataDeviceNameFmt    = `/dev/(sd[a-z]|xvd[a-c][a-z]?)`
+	dataDeviceNameErrMsg = "disk name given is not in the format: " + dataDeviceNameFmt
+
+	volumeTypeIO1 = "io1"
+
+	// AWSAccessKeyID and AWSSecretAccessKey are the secret keys holding the AWS credentials. The alternative keys are
+	// accepted as well, as they are used by the gardener cloudprovider secrets.
+	AWSAccessKeyID                = "providerAccessKeyId"
+	AWSSecretAccessKey            = "providerSecretAccessKey"
+	AWSAlternativeAccessKeyID     = "accessKeyID"
+	AWSAlternativeSecretAccessKey = "secretAccessKey"
+	// UserData is the secret key holding the cloud-init user data of the machine.
+	UserData = "userData"
+)
+
+var (
+	dataDeviceNameRegexp = regexp.MustCompile("^" + dataDeviceNameFmt + "$")
+	validVolumeTypes     = []string{"gp2", "gp3", "io1", "io2", "st1", "sc1", "standard"}
+)
+
+// ValidateAWSProviderSpec validates the AWSProviderSpec the same way the AWS provider does.
+func ValidateAWSProviderSpec(spec *AWSProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if spec == nil {
+		return append(allErrs, field.Required(fldPath, "ProviderSpec is required"))
+	}
+
+	if spec.AMI == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("ami"), "AMI is required"))
+	}
+	if spec.Region == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("region"), "Region is required"))
+	}
+	if spec.MachineType == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("machineType"), "MachineType is required"))
+	}
+	if spec.IAM.Name == "" && spec.IAM.ARN == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("iam"), "IAM Name or ARN is required"))
+	}
+
+	allErrs = append(allErrs, validateBlockDevices(spec.BlockDevices, fldPath.Child("blockDevices"))...)
+	allErrs = append(allErrs, validateCapacityReservations(spec.CapacityReservationTarget, fldPath.Child("capacityReservation"))...)
+	allErrs = append(allErrs, validateNetworkInterfaces(spec.NetworkInterfaces, fldPath.Child("networkInterfaces"))...)
+	allErrs = append(allErrs, validateSpecTags(spec.Tags, fldPath.Child("tags"))...)
+	allErrs = append(allErrs, validateInstanceMetadata(spec.InstanceMetadataOptions, fldPath.Child("instanceMetadataOptions"))...)
+	allErrs = append(allErrs, validateCPUOptions(spec.CPUOptions, fldPath.Child("cpuOptions"))...)
+
+	return allErrs
+}
+
+func validateSpecTags(tags map[string]string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	clusterName := ""
+	nodeRole := ""
+
+	for key := range tags {
+		if strings.Contains(key, "kubernetes.io/cluster/") {
+			clusterName = key
+		} else if strings.Contains(key, "kubernetes.io/role/") {
+			nodeRole = key
+		}
+	}
+
+	if clusterName == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("kubernetes.io/cluster/"), "Tag required of the form kubernetes.io/cluster/****"))
+	}
+	if nodeRole == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("kubernetes.io/role/"), "Tag required of the form kubernetes.io/role/****"))
+	}
+	return allErrs
+}
+
+func validateBlockDevices(blockDevices []AWSBlockDeviceMappingSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	rootPartitionCount := 0
+	names := map[string]int{}
+
+	for i, disk := range blockDevices {
+		idxPath := fldPath.Index(i)
+		if disk.DeviceName == "" {
+			rootPartitionCount++
+		} else {
+			if _, ok := names[disk.DeviceName]; ok {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("deviceName"), disk.DeviceName, "Device name cannot be duplicated"))
+			}
+			names[disk.DeviceName] = i
+			if !dataDeviceNameRegexp.MatchString(disk.DeviceName) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("deviceName"), disk.DeviceName, utilvalidation.RegexError(dataDeviceNameErrMsg, dataDeviceNameFmt, "/dev/sdf")))
+			}
+		}
+
+		if !slices.Contains(validVolumeTypes, disk.Ebs.VolumeType) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("ebs.volumeType"), disk.Ebs.VolumeType, validVolumeTypes))
+		}
+		if disk.Ebs.VolumeSize <= 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("ebs.volumeSize"), "Please mention a valid EBS volume size"))
+		}
+		if disk.Ebs.VolumeType == volumeTypeIO1 && disk.Ebs.Iops <= 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("ebs.iops"), "Please mention a valid EBS volume iops"))
+		}
+		if disk.Ebs.Iops < 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("ebs.iops"), disk.Ebs.Iops, "Please mention a valid EBS volume iops"))
+		}
+		if disk.Ebs.Throughput != nil && *disk.Ebs.Throughput <= 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("ebs.throughput"), *disk.Ebs.Throughput, "Throughput should be a positive value"))
+		}
+	}
+
+	if rootPartitionCount > 1 {
+		allErrs = append(allErrs, field.Required(fldPath, "Only one device can be specified as root"))
+	}
+	return allErrs
+}
+
+func validateCapacityReservations(capacityReservation *AWSCapacityReservationTargetSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if capacityReservation == nil {
+		return allErrs
+	}
+	if capacityReservation.CapacityReservationID != nil && capacityReservation.CapacityReservationResourceGroupArn != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "capacityReservationResourceGroupArn or capacityReservationId are optional but only one should be used"))
+	}
+	return allErrs
+}
+
+func validateNetworkInterfaces(networkInterfaces []AWSNetworkInterfaceSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(networkInterfaces) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child(""), "Mention at least one NetworkInterface"))
+		return allErrs
+	}
+	for i, nic := range networkInterfaces {
+		idxPath := fldPath.Index(i)
+		if nic.SubnetID == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("subnetID"), "SubnetID is required"))
+		}
+		if len(nic.SecurityGroupIDs) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("securityGroupIDs"), "Mention at least one securityGroupID"))
+			continue
+		}
+		for j, securityGroupID := range nic.SecurityGroupIDs {
+			if securityGroupID == "" {
+				allErrs = append(allErrs, field.Required(idxPath.Child("securityGroupIDs").Index(j), "securityGroupIDs cannot be blank"))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateInstanceMetadata(metadata *InstanceMetadataOptions, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if metadata == nil {
+		return allErrs
+	}
+	if metadata.HTTPEndpoint != nil && !slices.Contains([]string{"enabled", "disabled"}, *metadata.HTTPEndpoint) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("httpEndpoint"), *metadata.HTTPEndpoint, "Allowed values are either 'enabled' or 'disabled'"))
+	}
+	if metadata.HTTPPutResponseHopLimit != nil && (*metadata.HTTPPutResponseHopLimit < 1 || *metadata.HTTPPutResponseHopLimit > 64) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("httpPutResponseHopLimit"), *metadata.HTTPPutResponseHopLimit, "Only values between 1 and 64, both included, are accepted"))
+	}
+	if metadata.HTTPTokens != nil && !slices.Contains([]string{"required", "optional"}, *metadata.HTTPTokens) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("httpTokens"), *metadata.HTTPTokens, "Allowed values are either 'required' or 'optional'"))
+	}
+	return allErrs
+}
+
+func validateCPUOptions(cpuOptions *CPUOptions, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cpuOptions == nil {
+		return allErrs
+	}
+	if cpuOptions.CoreCount == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("coreCount"), "CoreCount is required"))
+	}
+	if cpuOptions.ThreadsPerCore == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("threadsPerCore"), "ThreadsPerCore is required"))
+	} else if *cpuOptions.ThreadsPerCore > 2 || *cpuOptions.ThreadsPerCore < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("threadsPerCore"), *cpuOptions.ThreadsPerCore, "ThreadsPerCore must be either '1' or '2'"))
+	}
+	return allErrs
+}
+
+// ValidateSecret validates that the secret of the MachineClass carries the AWS credentials and the userData the same
+// way the AWS provider does.
+func ValidateSecret(secret *corev1.Secret) []error {
+	var allErrs []error
+	if secret == nil {
+		return append(allErrs, fmt.Errorf("secretRef is required"))
+	}
+	if len(secret.Data[AWSAccessKeyID]) == 0 && len(secret.Data[AWSAlternativeAccessKeyID]) == 0 {
+		allErrs = append(allErrs, fmt.Errorf("secret %s or %s is required field", AWSAccessKeyID, AWSAlternativeAccessKeyID))
+	}
+	if len(secret.Data[AWSSecretAccessKey]) == 0 && len(secret.Data[AWSAlternativeSecretAccessKey]) == 0 {
+		allErrs = append(allErrs, fmt.Errorf("secret %s or %s is required field", AWSSecretAccessKey, AWSAlternativeSecretAccessKey))
+	}
+	if len(secret.Data[UserData]) == 0 {
+		allErrs = append(allErrs, fmt.Errorf("secret %s is required field", UserData))
+	}
+	return allErrs
+}
+
+// AccessKeyID returns the AWS access key id held by the secret.
+func AccessKeyID(secret *corev1.Secret) string {
+	if secret == nil {
+		return ""
+	}
+	if accessKeyID, ok := secret.Data[AWSAccessKeyID]; ok {
+		return string(accessKeyID)
+	}
+	return string(secret.Data[AWSAlternativeAccessKeyID])
+}
@@ -0,0 +1,159 @@
+package awsfake
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+)
+
+func validProviderSpec() *AWSProviderSpec {
+	return &AWSProviderSpec{
+		AMI:         "ami-123",
+		Region:      "eu-west-1",
+		MachineType: "m5.large",
+		IAM:         AWSIAMProfileSpec{Name: "shoot-nodes"},
+		BlockDevices: []AWSBlockDeviceMappingSpec{
+			{Ebs: AWSEbsBlockDeviceSpec{VolumeSize: 50, VolumeType: "gp3"}},
+		},
+		NetworkInterfaces: []AWSNetworkInterfaceSpec{
+			{SubnetID: "subnet-1", SecurityGroupIDs: []string{"sg-1"}},
+		},
+		Tags: map[string]string{
+			"kubernetes.io/cluster/shoot--dev--test": "1",
+			"kubernetes.io/role/node":                "1",
+		},
+	}
+}
+
+func TestValidateAWSProviderSpec(t *testing.T) {
+	tests := []struct {
+		name           string
+		mutate         func(spec *AWSProviderSpec)
+		expectedErrors []string
+	}{
+		{
+			name:   "valid spec",
+			mutate: func(spec *AWSProviderSpec) {},
+		},
+		{
+			name: "missing required fields",
+			mutate: func(spec *AWSProviderSpec) {
+				spec.AMI = ""
+				spec.IAM = AWSIAMProfileSpec{}
+				spec.NetworkInterfaces = nil
+				delete(spec.Tags, "kubernetes.io/role/node")
+			},
+			expectedErrors: []string{
+				"providerSpec.ami: Required value: AMI is required",
+				"providerSpec.iam: Required value: IAM Name or ARN is required",
+				"Mention at least one NetworkInterface",
+				"Tag required of the form kubernetes.io/role/****",
+			},
+		},
+		{
+			name: "invalid block devices",
+			mutate: func(spec *AWSProviderSpec) {
+				spec.BlockDevices = append(spec.BlockDevices,
+					AWSBlockDeviceMappingSpec{Ebs: AWSEbsBlockDeviceSpec{VolumeSize: 10, VolumeType: "gp2"}},
+					AWSBlockDeviceMappingSpec{DeviceName: "/dev/foo", Ebs: AWSEbsBlockDeviceSpec{VolumeType: "io1", Throughput: ptr.To[int64](0)}},
+				)
+			},
+			expectedErrors: []string{
+				"Only one device can be specified as root",
+				"providerSpec.blockDevices[2].deviceName: Invalid value: \"/dev/foo\"",
+				"providerSpec.blockDevices[2].ebs.volumeSize: Required value",
+				"providerSpec.blockDevices[2].ebs.iops: Required value",
+				"Throughput should be a positive value",
+			},
+		},
+		{
+			name: "invalid options",
+			mutate: func(spec *AWSProviderSpec) {
+				spec.CPUOptions = &CPUOptions{CoreCount: ptr.To[int64](2), ThreadsPerCore: ptr.To[int64](3)}
+				spec.InstanceMetadataOptions = &InstanceMetadataOptions{HTTPTokens: ptr.To("always")}
+				spec.CapacityReservationTarget = &AWSCapacityReservationTargetSpec{
+					CapacityReservationID:               ptr.To("cr-1"),
+					CapacityReservationResourceGroupArn: ptr.To("arn:cr"),
+				}
+			},
+			expectedErrors: []string{
+				"ThreadsPerCore must be either '1' or '2'",
+				"Allowed values are either 'required' or 'optional'",
+				"only one should be used",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := validProviderSpec()
+			tc.mutate(spec)
+			errs := ValidateAWSProviderSpec(spec, field.NewPath("providerSpec"))
+			if len(tc.expectedErrors) == 0 {
+				if len(errs) > 0 {
+					t.Errorf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			aggregated := errs.ToAggregate().Error()
+			for _, expected := range tc.expectedErrors {
+				if !strings.Contains(aggregated, expected) {
+					t.Errorf("expected error containing %q, got %q", expected, aggregated)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  *corev1.Secret
+		wantErr int
+	}{
+		{name: "nil secret", wantErr: 1},
+		{
+			name: "provider keys",
+			secret: &corev1.Secret{Data: map[string][]byte{
+				AWSAccessKeyID: []byte("AKIA"), AWSSecretAccessKey: []byte("secret"), UserData: []byte("#!/bin/bash"),
+			}},
+		},
+		{
+			name: "alternative keys",
+			secret: &corev1.Secret{Data: map[string][]byte{
+				AWSAlternativeAccessKeyID: []byte("AKIA"), AWSAlternativeSecretAccessKey: []byte("secret"), UserData: []byte("#!/bin/bash"),
+			}},
+		},
+		{name: "empty secret", secret: &corev1.Secret{}, wantErr: 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if errs := ValidateSecret(tc.secret); len(errs) != tc.wantErr {
+				t.Errorf("ValidateSecret() = %v, want %d error(s)", errs, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNilAWSProviderSpec(t *testing.T) {
+	if errs := ValidateAWSProviderSpec(nil, field.NewPath("providerSpec")); len(errs) != 1 || errs[0].Field != "providerSpec" {
+		t.Errorf("ValidateAWSProviderSpec(nil) = %v, want a single error on providerSpec", errs)
+	}
+}
+
+func TestDecodeProviderSpecAndSecret(t *testing.T) {
+	for _, raw := range []string{"null", "{"} {
+		mc := &v1alpha1.MachineClass{ObjectMeta: metav1.ObjectMeta{Name: "mc"}, ProviderSpec: runtime.RawExtension{Raw: []byte(raw)}}
+		spec, err := DecodeProviderSpecAndSecret(mc)
+		if st, ok := status.FromError(err); spec != nil || !ok || st.Code() != codes.InvalidArgument {
+			t.Errorf("DecodeProviderSpecAndSecret(%q) = %v, %v, want InvalidArgument", raw, spec, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package virtual
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// AnnotationCloudProviderData is the node annotation holding the JSON encoded CloudProviderData of a node that has
+// not been initialized by the simulated cloud-controller-manager yet.
+const AnnotationCloudProviderData = "virtual.gardener.cloud/cloud-provider-data"
+
+// DefaultCCMSyncPeriod is the period in seconds of the simulated cloud-controller-manager loop.
+const DefaultCCMSyncPeriod = 5
+
+// cloudProviderLabels are the node labels set by the cloud-controller-manager and not by the kubelet.
+var cloudProviderLabels = []string{
+	corev1.LabelInstanceType,
+	corev1.LabelInstanceTypeStable,
+	corev1.LabelTopologyRegion,
+	corev1.LabelTopologyZone,
+}
+
+// CloudControllerManagerConfig configures the simulated cloud-controller-manager. If Enabled, nodes register without
+// provider ID, addresses and cloud provider labels but with the uninitialized taint and are initialized after a random
+// delay between InstanceDelays.InitializeMin and InitializeMax. Nodes of terminated instances are then deleted by
+// the cloud-controller-manager instead of the driver.
+type CloudControllerManagerConfig struct {
+	Enabled bool
+	// SyncPeriod is the period in seconds in which nodes are initialized and deleted. Defaults to DefaultCCMSyncPeriod.
+	SyncPeriod int64 `json:",omitempty"`
+}
+
+// CloudProviderData holds what the cloud-controller-manager sets on a node when initializing it.
+type CloudProviderData struct {
+	ProviderID   string
+	Addresses    []corev1.NodeAddress
+	Labels       map[string]string
+	InitializeAt time.Time
+}
+
+// registerBare moves the provider ID, addresses and cloud provider labels of the node into the
+// AnnotationCloudProviderData and adds the uninitialized taint, the way a kubelet with an external cloud provider
+// registers a node.
+func registerBare(node *corev1.Node, initializeAt time.Time) error {
+	data := CloudProviderData{
+		ProviderID:   node.Spec.ProviderID,
+		Addresses:    node.Status.Addresses,
+		Labels:       make(map[string]string),
+		InitializeAt: initializeAt,
+	}
+	for _, l := range cloudProviderLabels {
+		if v, ok := node.Labels[l]; ok {
+			data.Labels[l] = v
+			delete(node.Labels, l)
+		}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("cannot encode cloud provider data of node %q: %w", node.Name, err)
+	}
+	node.Annotations[AnnotationCloudProviderData] = string(encoded)
+	node.Spec.ProviderID = ""
+	node.Status.Addresses = nil
+	node.Spec.Taints = addTaint(node.Spec.Taints, corev1.Taint{Key: TaintExternalCloudProvider, Value: "true", Effect: corev1.TaintEffectNoSchedule})
+	return nil
+}
+
+// cloudProviderDataOf returns the CloudProviderData of a node not yet initialized by the cloud-controller-manager.
+func cloudProviderDataOf(node corev1.Node) (data CloudProviderData, ok bool) {
+	encoded, ok := node.Annotations[AnnotationCloudProviderData]
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal([]byte(encoded), &data); err != nil {
+		klog.Errorf("Cannot decode cloud provider data of node %q: %v", node.Name, err)
+		return data, false
+	}
+	return
+}
+
+// initialized returns a copy of the node as it will be once initialized by the cloud-controller-manager, so
+// that uninitialized nodes are accounted for by their instance.
+func initialized(node corev1.Node) corev1.Node {
+	data, ok := cloudProviderDataOf(node)
+	if !ok {
+		return node
+	}
+	node = *node.DeepCopy()
+	applyCloudProviderData(&node, data)
+	return node
+}
+
+func applyCloudProviderData(node *corev1.Node, data CloudProviderData) {
+	node.Spec.ProviderID = data.ProviderID
+	node.Status.Addresses = data.Addresses
+	maps.Copy(node.Labels, data.Labels)
+	delete(node.Annotations, AnnotationCloudProviderData)
+	node.Spec.Taints = slices.DeleteFunc(node.Spec.Taints, func(t corev1.Taint) bool {
+		return t.Key == TaintExternalCloudProvider
+	})
+}
+
+// initializeNode initializes the node with the given CloudProviderData like the cloud node controller does.
+func initializeNode(ctx context.Context, client kubernetes.Interface, nodeName string, data CloudProviderData) (updated corev1.Node, err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		applyCloudProviderData(node, data)
+		node, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		node.Status.Addresses = data.Addresses
+		node, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		updated = *node
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("cannot initialize node %q: %w", nodeName, err)
+		return
+	}
+	klog.Infof("Initialized node %q with provider ID %q", nodeName, data.ProviderID)
+	return
+}
+
+// runCloudControllerManager periodically initializes the nodes whose initialization delay has passed and deletes
+// the nodes of terminated instances while the cloud-controller-manager simulation is enabled.
+func (d *DriverImpl) runCloudControllerManager(ctx context.Context) {
+	for {
+		d.mu.Lock()
+		ccm := d.simConfig.CloudControllerManager
+		if ccm.Enabled {
+			d.syncCloudControllerManager(ctx, time.Now())
+		}
+		d.mu.Unlock()
+		syncPeriod := time.Duration(cmp.Or(ccm.SyncPeriod, DefaultCCMSyncPeriod)) * time.Second
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syncPeriod):
+		}
+	}
+}
+
+func (d *DriverImpl) syncCloudControllerManager(ctx context.Context, now time.Time) {
+	for name, node := range d.managedNodes {
+		if _, ok := d.unjoinedInstances[name]; ok {
+			continue
+		}
+		if instanceStateOf(node) == InstanceStateTerminated {
+			err := d.client.CoreV1().Nodes().Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				klog.Errorf("Cannot delete node %q of terminated instance: %v", name, err)
+				continue
+			}
+			delete(d.managedNodes, name)
+			klog.Infof("Deleted node %q of terminated instance", name)
+			continue
+		}
+		data, ok := cloudProviderDataOf(node)
+		if !ok || now.Before(data.InitializeAt) {
+			continue
+		}
+		updated, err := initializeNode(ctx, d.client, name, data)
+		if apierrors.IsNotFound(err) {
+			delete(d.managedNodes, name)
+			continue
+		}
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		d.managedNodes[name] = updated
+	}
+}
@@ -0,0 +1,62 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCloudControllerManager(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "m1",
+			Labels:      map[string]string{corev1.LabelTopologyZone: "eu-west-1a", corev1.LabelInstanceTypeStable: "m5.large", corev1.LabelHostname: "m1"},
+			Annotations: map[string]string{},
+		},
+		Spec:   corev1.NodeSpec{ProviderID: "aws:///eu-west-1/i-1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.250.0.4"}}},
+	}
+	if err := registerBare(&node, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if node.Spec.ProviderID != "" || len(node.Status.Addresses) != 0 || node.Labels[corev1.LabelTopologyZone] != "" || node.Labels[corev1.LabelHostname] != "m1" {
+		t.Fatalf("expected bare node, got %+v", node)
+	}
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0].Key != TaintExternalCloudProvider {
+		t.Fatalf("expected uninitialized taint, got %v", node.Spec.Taints)
+	}
+	if got := initialized(node); got.Spec.ProviderID != "aws:///eu-west-1/i-1" || nodeInternalIP(got) != "10.250.0.4" {
+		t.Errorf("initialized() = %+v", got)
+	}
+	terminated := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "m2", Annotations: map[string]string{AnnotationInstanceState: string(InstanceStateTerminated)}}}
+
+	client := fake.NewClientset(&node, &terminated)
+	d := &DriverImpl{client: client, managedNodes: map[string]corev1.Node{node.Name: node, terminated.Name: terminated}}
+
+	d.syncCloudControllerManager(ctx, now)
+	if _, ok := cloudProviderDataOf(d.managedNodes["m1"]); !ok {
+		t.Error("expected node to remain uninitialized before its initialization delay")
+	}
+	if _, err := client.CoreV1().Nodes().Get(ctx, "m2", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected node of terminated instance to be deleted, got err = %v", err)
+	}
+
+	d.syncCloudControllerManager(ctx, now.Add(2*time.Minute))
+	updated, err := client.CoreV1().Nodes().Get(ctx, "m1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Spec.ProviderID != "aws:///eu-west-1/i-1" || len(updated.Spec.Taints) != 0 || updated.Labels[corev1.LabelTopologyZone] != "eu-west-1a" {
+		t.Errorf("expected initialized node, got %+v", updated)
+	}
+	if nodeInternalIP(*updated) != "10.250.0.4" {
+		t.Errorf("expected addresses of initialized node, got %v", updated.Status.Addresses)
+	}
+}
@@ -0,0 +1,47 @@
+package virtual
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RevocationReasonAuthFailure simulates credentials EC2 cannot validate, eg: a deleted access key.
+	RevocationReasonAuthFailure = "AuthFailure"
+	// RevocationReasonUnauthorizedOperation simulates valid credentials lacking the IAM permissions for EC2.
+	RevocationReasonUnauthorizedOperation = "UnauthorizedOperation"
+)
+
+// RevokedCredential marks the AWS access key with the given AccessKeyID as revoked. Reason is either AuthFailure
+// (the default) or UnauthorizedOperation.
+type RevokedCredential struct {
+	AccessKeyID string
+	Reason      string `json:",omitempty"`
+}
+
+// checkCredentials validates the secret of the MachineClass and returns the error the AWS provider would return if
+// the credentials held by it are revoked as per the SimulationConfig.
+func (d *DriverImpl) checkCredentials(secret *corev1.Secret) error {
+	if errs := awsfake.ValidateSecret(secret); len(errs) > 0 {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Error while validating secret %v", errors.Join(errs...)))
+	}
+	accessKeyID := awsfake.AccessKeyID(secret)
+	idx := slices.IndexFunc(d.simConfig.RevokedCredentials, func(rc RevokedCredential) bool {
+		return rc.AccessKeyID == accessKeyID
+	})
+	if idx < 0 {
+		return nil
+	}
+	switch d.simConfig.RevokedCredentials[idx].Reason {
+	case RevocationReasonUnauthorizedOperation:
+		return status.Error(codes.PermissionDenied, "UnauthorizedOperation: You are not authorized to perform this operation.")
+	default:
+		return status.Error(codes.Internal, "AuthFailure: AWS was not able to validate the provided access credentials")
+	}
+}
@@ -0,0 +1,49 @@
+package virtual
+
+import (
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCheckCredentials(t *testing.T) {
+	secretFor := func(accessKeyID string) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{
+			awsfake.AWSAccessKeyID:     []byte(accessKeyID),
+			awsfake.AWSSecretAccessKey: []byte("secret"),
+			awsfake.UserData:           []byte("#!/bin/bash"),
+		}}
+	}
+	d := &DriverImpl{simConfig: SimulationConfig{RevokedCredentials: []RevokedCredential{
+		{AccessKeyID: "AKIA-DELETED"},
+		{AccessKeyID: "AKIA-NO-PERMISSIONS", Reason: RevocationReasonUnauthorizedOperation},
+	}}}
+	tests := []struct {
+		name     string
+		secret   *corev1.Secret
+		wantCode codes.Code
+	}{
+		{name: "valid credentials", secret: secretFor("AKIA-VALID"), wantCode: codes.OK},
+		{name: "missing keys", secret: &corev1.Secret{}, wantCode: codes.InvalidArgument},
+		{name: "auth failure", secret: secretFor("AKIA-DELETED"), wantCode: codes.Internal},
+		{name: "unauthorized operation", secret: secretFor("AKIA-NO-PERMISSIONS"), wantCode: codes.PermissionDenied},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := d.checkCredentials(tc.secret)
+			if err == nil {
+				if tc.wantCode != codes.OK {
+					t.Fatalf("checkCredentials() err = nil, want code %s", tc.wantCode)
+				}
+				return
+			}
+			s, _ := status.FromError(err)
+			if s.Code() != tc.wantCode {
+				t.Errorf("checkCredentials() code = %s, want %s", s.Code(), tc.wantCode)
+			}
+		})
+	}
+}
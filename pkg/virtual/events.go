@@ -0,0 +1,280 @@
+package virtual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// AnnotationInstanceEvent is the node annotation requesting an instance event of the given type on demand, eg:
+// kubectl annotate node <node> virtual.gardener.cloud/instance-event=reboot
+const AnnotationInstanceEvent = "virtual.gardener.cloud/instance-event"
+
+const (
+	// InstanceEventReboot makes the node NotReady for a random duration between InstanceDelays.RebootMin and
+	// RebootMax after which the containers of its pods are restarted.
+	InstanceEventReboot = "reboot"
+	// InstanceEventStop stops the instance, which keeps it but makes its node unreachable.
+	InstanceEventStop = "stop"
+	// InstanceEventRetirement retires the instance, which is terminated after shutting down.
+	InstanceEventRetirement = "retirement"
+	// InstanceEventShutdown shuts the node down gracefully as configured by the NodeShutdownConfig, which stops the
+	// instance.
+	InstanceEventShutdown = "shutdown"
+	// InstanceEventNonGracefulShutdown shuts the node down without the kubelet noticing, which stops the instance and
+	// leaves its pods terminating until the out-of-service taint is added to the node.
+	InstanceEventNonGracefulShutdown = "non-graceful-shutdown"
+
+	// DefaultRebootDuration is the time a node is NotReady during a reboot if InstanceDelays.RebootMax is not set.
+	DefaultRebootDuration = 30 * time.Second
+	// instanceEventsSyncPeriod is the period in which scheduled and requested instance events are processed.
+	instanceEventsSyncPeriod = 5 * time.Second
+)
+
+// ScheduledInstanceEvent is an instance event of the given Type, which is either reboot, stop, retirement, shutdown
+// or non-graceful-shutdown, that happens At the given time to the instance of the machine with the given MachineName
+// or, if unset, to all instances of the given MachineClass.
+type ScheduledInstanceEvent struct {
+	Type         string
+	MachineName  string `json:",omitempty"`
+	MachineClass string `json:",omitempty"`
+	At           time.Time
+}
+
+func (e ScheduledInstanceEvent) String() string {
+	return fmt.Sprintf("(Type:%s, MachineName:%s, MachineClass:%s, At:%s)", e.Type, e.MachineName, e.MachineClass, e.At.Format(time.RFC3339))
+}
+
+// matches reports whether the ScheduledInstanceEvent targets the instance of the given node.
+func (e ScheduledInstanceEvent) matches(node corev1.Node) bool {
+	if e.MachineName != "" {
+		return machineNameOf(node) == e.MachineName
+	}
+	tags, _ := instanceTagsOf(node)
+	return e.MachineClass != "" && tags[TagMachineClass] == e.MachineClass
+}
+
+// TriggerInstanceEvent simulates an instance event of the given type for the instance of the given machine.
+func (d *DriverImpl) TriggerInstanceEvent(ctx context.Context, machineName, eventType string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, ok := d.nodeForMachine(machineName)
+	if !ok {
+		return fmt.Errorf("%w: machine %q", ErrInstanceNotFound, machineName)
+	}
+	return d.triggerInstanceEvent(ctx, node, eventType)
+}
+
+// ErrInstanceNotFound is returned when a machine has no virtual instance.
+var ErrInstanceNotFound = errors.New("instance not found")
+
+func (d *DriverImpl) triggerInstanceEvent(ctx context.Context, node corev1.Node, eventType string) (err error) {
+	state := instanceStateOf(node)
+	if state != InstanceStateRunning {
+		return fmt.Errorf("cannot simulate %s of instance of node %q as it is %s", eventType, node.Name, state)
+	}
+	_, unjoined := d.unjoinedInstances[node.Name]
+	simConfig := d.simConfig.For(nodeOverrideTarget(node))
+	klog.Infof("Simulating %s of instance of node %q", eventType, node.Name)
+	switch eventType {
+	case InstanceEventReboot:
+		if unjoined {
+			return nil
+		}
+		err = setNodeUnreachable(ctx, d.client, node.Name, false)
+		if err != nil {
+			return
+		}
+		rebootDuration := DefaultRebootDuration
+		if simConfig.InstanceDelays.RebootMax > 0 {
+			rebootDuration = randomDuration(simConfig.InstanceDelays.RebootMin, simConfig.InstanceDelays.RebootMax)
+		}
+		time.AfterFunc(rebootDuration, func() {
+			d.completeReboot(context.Background(), node.Name)
+		})
+	case InstanceEventStop:
+		err = d.stopInstance(ctx, node.Name)
+	case InstanceEventRetirement:
+		if unjoined {
+			_, err = d.updateInstanceAnnotations(ctx, node.Name, map[string]string{AnnotationInstanceState: string(InstanceStateShuttingDown)})
+		} else {
+			_, err = setInstanceState(ctx, d.client, node.Name, InstanceStateShuttingDown, false)
+		}
+		if err != nil {
+			return
+		}
+		d.scheduleTermination(node.Name, randomDuration(simConfig.InstanceDelays.DeleteMin, simConfig.InstanceDelays.DeleteMax))
+	case InstanceEventShutdown:
+		if unjoined {
+			return d.stopInstance(ctx, node.Name)
+		}
+		err = d.shutdownNodeGracefully(ctx, node.Name)
+	case InstanceEventNonGracefulShutdown:
+		err = d.shutdownNodeNonGracefully(ctx, node.Name)
+	default:
+		err = fmt.Errorf("unknown instance event type %q", eventType)
+	}
+	return
+}
+
+// completeReboot makes the node Ready again after a reboot and restarts the containers of its pods unless its
+// instance was stopped, shut down or deleted during the reboot.
+func (d *DriverImpl) completeReboot(ctx context.Context, nodeName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, err := d.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("Failed to get node %q after reboot: %v", nodeName, err)
+		return
+	}
+	if state := instanceStateOf(*node); state != InstanceStateRunning {
+		klog.Infof("Instance of node %q is %s - not completing its reboot", nodeName, state)
+		return
+	}
+	_, err = makeNodeReady(d.client, nodeName)
+	if err != nil {
+		klog.Errorf("Failed to make node %q Ready after reboot: %v", nodeName, err)
+		return
+	}
+	err = removeNodeTaint(ctx, d.client, nodeName, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoSchedule})
+	if err != nil {
+		klog.Errorf("Failed to remove unreachable taint from node %q after reboot: %v", nodeName, err)
+	}
+	err = restartPodContainers(ctx, d.client, nodeName)
+	if err != nil {
+		klog.Errorf("Failed to restart containers of pods on node %q after reboot: %v", nodeName, err)
+	}
+	err = d.reloadNodes(ctx)
+	if err != nil {
+		klog.Errorf("Failed to reload nodes after reboot of node %q: %v", nodeName, err)
+	}
+}
+
+// setNodeUnreachable sets the Ready condition of the node to Unknown and adds the unreachable taints the node
+// lifecycle controller adds once the kubelet stops posting the node status. The NoExecute taint evicting the pods is
+// only added if evict is set.
+func setNodeUnreachable(ctx context.Context, client kubernetes.Interface, nodeName string, evict bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		node.Spec.Taints = addTaint(node.Spec.Taints, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoSchedule})
+		if evict {
+			now := metav1.Now()
+			node.Spec.Taints = addTaint(node.Spec.Taints, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute, TimeAdded: &now})
+		}
+		node, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		setReadyConditionUnknown(node)
+		_, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// restartPodContainers resets the container restart counts of the pods on the given node and marks their
+// containers started anew, as the containers of a rebooted node are recreated.
+func restartPodContainers(ctx context.Context, client kubernetes.Interface, nodeName string) error {
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list pods of node %q: %w", nodeName, err)
+	}
+	now := metav1.Now()
+	for _, pod := range pods.Items {
+		for i := range pod.Status.ContainerStatuses {
+			cs := &pod.Status.ContainerStatuses[i]
+			cs.RestartCount = 0
+			cs.LastTerminationState = corev1.ContainerState{}
+			if cs.State.Running != nil {
+				cs.State.Running.StartedAt = now
+			}
+		}
+		_, err = client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, &pod, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("cannot update status of pod %q: %w", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// runInstanceEvents periodically processes the instance events requested via the AnnotationInstanceEvent and the
+// ScheduledInstanceEvents of the SimulationConfig that are due, and force deletes the pods of out-of-service nodes.
+func (d *DriverImpl) runInstanceEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(instanceEventsSyncPeriod):
+		}
+		nodeList, err := d.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			klog.Errorf("Cannot list nodes to process instance events: %v", err)
+			continue
+		}
+		d.mu.Lock()
+		d.processRequestedInstanceEvents(ctx, nodeList.Items)
+		d.processScheduledInstanceEvents(ctx, time.Now())
+		d.mu.Unlock()
+		forceDeleteOutOfServicePods(ctx, d.client, nodeList.Items)
+	}
+}
+
+func (d *DriverImpl) processRequestedInstanceEvents(ctx context.Context, nodes []corev1.Node) {
+	for _, node := range nodes {
+		eventType, ok := node.Annotations[AnnotationInstanceEvent]
+		if !ok {
+			continue
+		}
+		err := removeNodeAnnotation(ctx, d.client, node.Name, AnnotationInstanceEvent)
+		if err != nil {
+			klog.Errorf("Cannot remove instance event annotation of node %q: %v", node.Name, err)
+			continue
+		}
+		err = d.triggerInstanceEvent(ctx, node, eventType)
+		if err != nil {
+			klog.Errorf("Cannot simulate requested instance event: %v", err)
+		}
+	}
+}
+
+func (d *DriverImpl) processScheduledInstanceEvents(ctx context.Context, now time.Time) {
+	for _, e := range d.simConfig.InstanceEvents {
+		if now.Before(e.At) || d.firedInstanceEvents[e.String()] {
+			continue
+		}
+		d.firedInstanceEvents[e.String()] = true
+		for _, node := range d.managedNodes {
+			if !e.matches(node) {
+				continue
+			}
+			err := d.triggerInstanceEvent(ctx, node, e.Type)
+			if err != nil {
+				klog.Errorf("Cannot simulate scheduled instance event %s: %v", e, err)
+			}
+		}
+	}
+}
+
+func removeNodeAnnotation(ctx context.Context, client kubernetes.Interface, nodeName, key string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		delete(node.Annotations, key)
+		_, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
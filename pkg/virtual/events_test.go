@@ -0,0 +1,118 @@
+package virtual
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInstanceEvents(t *testing.T) {
+	ctx := context.Background()
+	newNode := func(name string, annotations map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{LabelMachineName: name}, Annotations: annotations},
+			Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionTrue)},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "rebooted"},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "c", RestartCount: 3}}},
+	}
+	client := fake.NewClientset(
+		newNode("rebooted", nil),
+		newNode("stopped", map[string]string{AnnotationInstanceEvent: InstanceEventStop}),
+		newNode("retired", nil),
+		pod,
+	)
+	d := &DriverImpl{
+		client:              client,
+		managedNodes:        make(map[string]corev1.Node),
+		unjoinedInstances:   make(map[string]corev1.Node),
+		firedInstanceEvents: make(map[string]bool),
+		simConfig: SimulationConfig{
+			// reboots and terminations are completed explicitly below
+			InstanceDelays: InstanceDelays{DeleteMin: 3600, DeleteMax: 3600, RebootMin: 3600, RebootMax: 3600},
+			InstanceEvents: []ScheduledInstanceEvent{
+				{Type: InstanceEventRetirement, MachineName: "retired", At: time.Now().Add(-time.Minute)},
+				{Type: InstanceEventReboot, MachineName: "retired", At: time.Now().Add(time.Hour)},
+			},
+		},
+	}
+	if err := d.reloadNodes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.TriggerInstanceEvent(ctx, "rebooted", InstanceEventReboot); err != nil {
+		t.Fatalf("TriggerInstanceEvent() err = %v", err)
+	}
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.processRequestedInstanceEvents(ctx, nodeList.Items)
+	d.processScheduledInstanceEvents(ctx, time.Now())
+
+	getNode := func(name string) *corev1.Node {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	unreachable := func(node *corev1.Node, effect corev1.TaintEffect) bool {
+		return slices.ContainsFunc(node.Spec.Taints, func(t corev1.Taint) bool {
+			return t.Key == corev1.TaintNodeUnreachable && t.Effect == effect
+		})
+	}
+
+	rebooted := getNode("rebooted")
+	if rebooted.Status.Conditions[0].Status != corev1.ConditionUnknown || !unreachable(rebooted, corev1.TaintEffectNoSchedule) {
+		t.Errorf("rebooting node should be unreachable, got conditions %v and taints %v", rebooted.Status.Conditions, rebooted.Spec.Taints)
+	}
+	if got := instanceStateOf(*rebooted); got != InstanceStateRunning {
+		t.Errorf("instance state of rebooting node = %q, want %q", got, InstanceStateRunning)
+	}
+	d.completeReboot(ctx, "rebooted")
+	rebooted = getNode("rebooted")
+	if rebooted.Status.Conditions[0].Status != corev1.ConditionTrue || unreachable(rebooted, corev1.TaintEffectNoSchedule) {
+		t.Errorf("rebooted node should be Ready, got conditions %v and taints %v", rebooted.Status.Conditions, rebooted.Spec.Taints)
+	}
+	restarted, err := client.CoreV1().Pods("default").Get(ctx, "p1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.Status.ContainerStatuses[0].RestartCount; got != 0 {
+		t.Errorf("restart count after reboot = %d, want 0", got)
+	}
+
+	stopped := getNode("stopped")
+	if got := instanceStateOf(*stopped); got != InstanceStateStopped {
+		t.Errorf("instance state of stopped node = %q, want %q", got, InstanceStateStopped)
+	}
+	if _, ok := stopped.Annotations[AnnotationInstanceEvent]; ok {
+		t.Errorf("expected %s annotation to be removed", AnnotationInstanceEvent)
+	}
+	if stopped.Status.Conditions[0].Status != corev1.ConditionUnknown || !unreachable(stopped, corev1.TaintEffectNoExecute) {
+		t.Errorf("stopped node should be unreachable, got conditions %v and taints %v", stopped.Status.Conditions, stopped.Spec.Taints)
+	}
+	d.completeReboot(ctx, "stopped")
+	if stopped = getNode("stopped"); stopped.Status.Conditions[0].Status != corev1.ConditionUnknown {
+		t.Errorf("expected reboot completing after stop to leave node unreachable, got conditions %v", stopped.Status.Conditions)
+	}
+
+	if got := instanceStateOf(*getNode("retired")); got != InstanceStateShuttingDown {
+		t.Errorf("instance state of retired node = %q, want %q", got, InstanceStateShuttingDown)
+	}
+	if len(d.firedInstanceEvents) != 1 {
+		t.Errorf("fired instance events = %v, want only the retirement", d.firedInstanceEvents)
+	}
+	if err = d.TriggerInstanceEvent(ctx, "retired", InstanceEventReboot); err == nil {
+		t.Error("expected reboot of shutting-down instance to fail")
+	}
+}
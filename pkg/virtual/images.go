@@ -0,0 +1,126 @@
+package virtual
+
+import (
+	"cmp"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// MachineImageCatalogPath is the path of the machine image catalog generated by `dev setup` from the Worker status.
+var MachineImageCatalogPath = "gen/machine-images.json"
+
+// MachineImage describes the operating system image behind an AMI. OSImage, KernelVersion and
+// ContainerRuntimeVersion are defaulted from the image Name and Version when empty.
+type MachineImage struct {
+	AMI                     string
+	Name                    string
+	Version                 string
+	Architecture            string `json:",omitempty"`
+	OSImage                 string `json:",omitempty"`
+	KernelVersion           string `json:",omitempty"`
+	ContainerRuntimeVersion string `json:",omitempty"`
+}
+
+// MachineImageCatalog holds the known MachineImages keyed by AMI.
+type MachineImageCatalog map[string]MachineImage
+
+// DefaultMachineImageName is assumed for AMIs missing from the catalog as it is the default image of gardener shoots.
+const DefaultMachineImageName = "gardenlinux"
+
+// machineImageDefaults holds the os image format (with the image version as argument), kernel version (with the
+// architecture as argument) and container runtime version of well known machine images.
+var machineImageDefaults = map[string]struct {
+	osImageFmt       string
+	kernelVersionFmt string
+	containerRuntime string
+}{
+	"gardenlinux": {"Garden Linux %s", "6.6.63-cloud-%s", "containerd://1.7.22"},
+	"suse-chost":  {"SUSE Linux Enterprise Server 15 SP5 %s", "5.14.21-150500.55.83-default-%s", "containerd://1.7.21"},
+	"ubuntu":      {"Ubuntu %s LTS", "6.5.0-1022-aws-%s", "containerd://1.7.12"},
+}
+
+// LoadMachineImageCatalog reads the MachineImageCatalog at the given path. A missing file yields an empty catalog.
+func LoadMachineImageCatalog(catalogPath string) (catalog MachineImageCatalog, err error) {
+	catalog = make(MachineImageCatalog)
+	if !FileExists(catalogPath) {
+		return
+	}
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		err = fmt.Errorf("cannot read machine image catalog %q: %w", catalogPath, err)
+		return
+	}
+	var images []MachineImage
+	err = json.Unmarshal(data, &images)
+	if err != nil {
+		err = fmt.Errorf("cannot parse machine image catalog %q: %w", catalogPath, err)
+		return
+	}
+	for _, image := range images {
+		catalog[image.AMI] = image
+	}
+	klog.Infof("LoadMachineImageCatalog loaded %d machine images from %q", len(catalog), catalogPath)
+	return
+}
+
+// NodeSystemInfo returns the NodeSystemInfo a kubelet of the given version reports on an instance booted from the
+// given AMI with the given architecture.
+func (c MachineImageCatalog) NodeSystemInfo(ami, arch, kubeletVersion string) (info corev1.NodeSystemInfo, err error) {
+	image, ok := c[ami]
+	if !ok {
+		klog.V(3).Infof("AMI %q is not in the machine image catalog - assuming %s", ami, DefaultMachineImageName)
+		image = MachineImage{AMI: ami, Name: DefaultMachineImageName}
+	}
+	arch = cmp.Or(image.Architecture, arch)
+	defaults := machineImageDefaults[image.Name]
+	if image.OSImage == "" && defaults.osImageFmt != "" {
+		image.OSImage = strings.TrimSpace(fmt.Sprintf(defaults.osImageFmt, image.Version))
+	}
+	if image.KernelVersion == "" && defaults.kernelVersionFmt != "" {
+		image.KernelVersion = fmt.Sprintf(defaults.kernelVersionFmt, arch)
+	}
+	image.ContainerRuntimeVersion = cmp.Or(image.ContainerRuntimeVersion, defaults.containerRuntime)
+	machineID, err := randomHex(16)
+	if err != nil {
+		return
+	}
+	bootID, err := randomHex(16)
+	if err != nil {
+		return
+	}
+	info = corev1.NodeSystemInfo{
+		MachineID:               machineID,
+		SystemUUID:              "ec2" + machineID[3:8] + "-" + machineID[8:12] + "-" + machineID[12:16] + "-" + machineID[16:20] + "-" + machineID[20:],
+		BootID:                  bootID[0:8] + "-" + bootID[8:12] + "-" + bootID[12:16] + "-" + bootID[16:20] + "-" + bootID[20:],
+		KernelVersion:           image.KernelVersion,
+		OSImage:                 image.OSImage,
+		ContainerRuntimeVersion: image.ContainerRuntimeVersion,
+		KubeletVersion:          normalizeVersion(kubeletVersion),
+		OperatingSystem:         "linux",
+		Architecture:            arch,
+	}
+	return
+}
+
+// normalizeVersion prefixes the given kubernetes version with 'v' as reported by the kubelet.
+func normalizeVersion(version string) string {
+	if version == "" || strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+func randomHex(numBytes int) (string, error) {
+	bytes := make([]byte, numBytes)
+	if _, err := crand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,36 @@
+package virtual
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNodeSystemInfo(t *testing.T) {
+	catalog := MachineImageCatalog{
+		"ami-123": {AMI: "ami-123", Name: "gardenlinux", Version: "1592.4.0", Architecture: "arm64"},
+	}
+	info, err := catalog.NodeSystemInfo("ami-123", "amd64", "1.31.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.OSImage != "Garden Linux 1592.4.0" {
+		t.Errorf("expected OSImage %q, got %q", "Garden Linux 1592.4.0", info.OSImage)
+	}
+	if info.Architecture != "arm64" || !strings.HasSuffix(info.KernelVersion, "arm64") {
+		t.Errorf("expected architecture of the image arm64, got %q and kernel %q", info.Architecture, info.KernelVersion)
+	}
+	if info.KubeletVersion != "v1.31.2" {
+		t.Errorf("expected kubelet version v1.31.2, got %q", info.KubeletVersion)
+	}
+	if !strings.HasPrefix(info.SystemUUID, "ec2") || len(info.SystemUUID) != 36 {
+		t.Errorf("expected AWS style system UUID, got %q", info.SystemUUID)
+	}
+
+	info, err = catalog.NodeSystemInfo("ami-unknown", "amd64", "v1.31.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.OSImage != "Garden Linux" || info.ContainerRuntimeVersion == "" {
+		t.Errorf("expected gardenlinux defaults for unknown AMI, got %+v", info)
+	}
+}
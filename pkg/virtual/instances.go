@@ -0,0 +1,193 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// AnnotationInstanceState is the node annotation holding the EC2 state of the instance backing the node.
+	AnnotationInstanceState = "virtual.gardener.cloud/instance-state"
+	// AnnotationInstanceInitialized marks an instance that was initialized via InitializeMachine.
+	AnnotationInstanceInitialized = "virtual.gardener.cloud/instance-initialized"
+	// AnnotationTerminationStuck marks an instance whose termination is simulated to never complete.
+	AnnotationTerminationStuck = "virtual.gardener.cloud/termination-stuck"
+)
+
+// InstanceState is the state of an EC2 instance.
+type InstanceState string
+
+const (
+	InstanceStatePending      InstanceState = "pending"
+	InstanceStateRunning      InstanceState = "running"
+	InstanceStateStopping     InstanceState = "stopping"
+	InstanceStateStopped      InstanceState = "stopped"
+	InstanceStateShuttingDown InstanceState = "shutting-down"
+	InstanceStateTerminated   InstanceState = "terminated"
+)
+
+// instanceStateOf returns the InstanceState of the instance backing the given node. Nodes without the
+// AnnotationInstanceState are running.
+func instanceStateOf(node corev1.Node) InstanceState {
+	if state, ok := node.Annotations[AnnotationInstanceState]; ok {
+		return InstanceState(state)
+	}
+	return InstanceStateRunning
+}
+
+// instanceExists reports whether an instance in the given state is still listed by the AWS provider.
+func instanceExists(state InstanceState) bool {
+	return state != InstanceStateShuttingDown && state != InstanceStateTerminated
+}
+
+// updateInstanceAnnotations sets the given annotations on the node of the instance with the given node name, which
+// is updated in-memory for instances whose node never registered.
+func (d *DriverImpl) updateInstanceAnnotations(ctx context.Context, nodeName string, annotations map[string]string) (updated corev1.Node, err error) {
+	if node, ok := d.unjoinedInstances[nodeName]; ok {
+		updated = *node.DeepCopy()
+		maps.Copy(updated.Annotations, annotations)
+		d.unjoinedInstances[nodeName] = updated
+		d.managedNodes[nodeName] = updated
+		return
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := d.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Annotations == nil {
+			node.Annotations = make(map[string]string)
+		}
+		maps.Copy(node.Annotations, annotations)
+		node, err = d.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		updated = *node
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("cannot annotate node %q: %w", nodeName, err)
+		return
+	}
+	d.managedNodes[nodeName] = updated
+	return
+}
+
+// setInstanceState records the given InstanceState on the node. Shutting down instances additionally carry the
+// AnnotationTerminationStuck if stuck is set and their node turns NotReady with status Unknown as the kubelet stops
+// posting its status.
+func setInstanceState(ctx context.Context, client kubernetes.Interface, nodeName string, state InstanceState, stuck bool) (updated corev1.Node, err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Annotations == nil {
+			node.Annotations = make(map[string]string)
+		}
+		node.Annotations[AnnotationInstanceState] = string(state)
+		if stuck {
+			node.Annotations[AnnotationTerminationStuck] = "true"
+		}
+		node, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		if state == InstanceStateShuttingDown {
+			setReadyConditionUnknown(node)
+			node, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
+		updated = *node
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("cannot set instance state of node %q to %q: %w", nodeName, state, err)
+		return
+	}
+	klog.Infof("Instance of node %q is %s", nodeName, state)
+	return
+}
+
+// setReadyConditionUnknown sets the Ready condition of the node to Unknown the way the node lifecycle controller
+// does once the kubelet stops posting the node status.
+func setReadyConditionUnknown(node *corev1.Node) {
+	now := metav1.NewTime(time.Now())
+	for i, c := range node.Status.Conditions {
+		if c.Type != corev1.NodeReady {
+			continue
+		}
+		node.Status.Conditions[i].Status = corev1.ConditionUnknown
+		node.Status.Conditions[i].Reason = "NodeStatusUnknown"
+		node.Status.Conditions[i].Message = "Kubelet stopped posting node status."
+		node.Status.Conditions[i].LastTransitionTime = now
+	}
+}
+
+// scheduleTermination terminates the shutting-down instance of the given node after the given delay.
+func (d *DriverImpl) scheduleTermination(nodeName string, delay time.Duration) {
+	klog.Infof("Terminating instance of node %q after %s", nodeName, delay)
+	time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		err := d.terminateInstance(context.Background(), nodeName)
+		if err != nil {
+			klog.Errorf("Failed to terminate instance of node %q: %v", nodeName, err)
+		}
+	})
+}
+
+// terminateInstance marks the instance of the given node terminated and deletes the node as the node lifecycle
+// controller of the cloud-controller-manager does for nodes whose instance is gone, unless the cloud-controller-manager
+// is simulated.
+func (d *DriverImpl) terminateInstance(ctx context.Context, nodeName string) error {
+	if _, ok := d.unjoinedInstances[nodeName]; ok {
+		delete(d.unjoinedInstances, nodeName)
+		delete(d.managedNodes, nodeName)
+		klog.Infof("Terminated instance of unregistered node %q", nodeName)
+		return nil
+	}
+	updated, err := setInstanceState(ctx, d.client, nodeName, InstanceStateTerminated, false)
+	if apierrors.IsNotFound(err) {
+		delete(d.managedNodes, nodeName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d.simConfig.CloudControllerManager.Enabled {
+		// the simulated cloud-controller-manager deletes the node
+		d.managedNodes[nodeName] = updated
+		return nil
+	}
+	err = d.client.CoreV1().Nodes().Delete(ctx, nodeName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("cannot delete node %q of terminated instance: %w", nodeName, err)
+	}
+	delete(d.managedNodes, nodeName)
+	klog.Infof("Deleted node %q of terminated instance", nodeName)
+	return nil
+}
+
+// resumeTerminations schedules the termination of the shutting-down instances that are not stuck, which were left
+// behind by a previous run of the driver.
+func (d *DriverImpl) resumeTerminations() {
+	for _, n := range d.managedNodes {
+		if instanceStateOf(n) == InstanceStateShuttingDown && n.Annotations[AnnotationTerminationStuck] != "true" {
+			simConfig := d.simConfig.For(nodeOverrideTarget(n))
+			d.scheduleTermination(n.Name, randomDuration(simConfig.InstanceDelays.DeleteMin, simConfig.InstanceDelays.DeleteMax))
+		}
+	}
+}
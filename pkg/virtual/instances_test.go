@@ -0,0 +1,143 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeleteMachineLifecycle(t *testing.T) {
+	ctx := context.Background()
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1", Labels: map[string]string{LabelMachineName: "m1"}},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///eu-west-1/i-1"},
+		Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionTrue)},
+	}
+	client := fake.NewClientset(&node)
+	d := &DriverImpl{
+		client:       client,
+		managedNodes: map[string]corev1.Node{node.Name: node},
+		// terminations are triggered explicitly below
+		simConfig: SimulationConfig{InstanceDelays: InstanceDelays{DeleteMin: 3600, DeleteMax: 3600}},
+	}
+	req := &driver.DeleteMachineRequest{
+		Machine: &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "m1"}},
+		Secret: &corev1.Secret{Data: map[string][]byte{
+			awsfake.AWSAccessKeyID: []byte("AKIA"), awsfake.AWSSecretAccessKey: []byte("secret"), awsfake.UserData: []byte("#!/bin/bash"),
+		}},
+	}
+
+	for range 2 {
+		if _, err := d.DeleteMachine(ctx, req); err != nil {
+			t.Fatalf("DeleteMachine() err = %v", err)
+		}
+		if got := instanceStateOf(d.managedNodes["m1"]); got != InstanceStateShuttingDown {
+			t.Fatalf("instance state = %q, want %q", got, InstanceStateShuttingDown)
+		}
+	}
+	updated, err := client.CoreV1().Nodes().Get(ctx, "m1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Conditions[0].Status != corev1.ConditionUnknown {
+		t.Errorf("Ready condition = %s, want %s", updated.Status.Conditions[0].Status, corev1.ConditionUnknown)
+	}
+
+	if err = d.terminateInstance(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.CoreV1().Nodes().Get(ctx, "m1", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected node of terminated instance to be deleted, got err = %v", err)
+	}
+	_, err = d.DeleteMachine(ctx, req)
+	if s, _ := status.FromError(err); s.Code() != codes.NotFound {
+		t.Errorf("DeleteMachine() of terminated instance err = %v, want code %s", err, codes.NotFound)
+	}
+}
+
+func TestGetMachineStatus(t *testing.T) {
+	ctx := context.Background()
+	newNode := func(name string, state InstanceState, initialized bool) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{LabelMachineName: name},
+				Annotations: map[string]string{AnnotationInstanceState: string(state)},
+			},
+			Spec: corev1.NodeSpec{ProviderID: "aws:///eu-west-1/i-" + name},
+		}
+		if initialized {
+			node.Annotations[AnnotationInstanceInitialized] = "true"
+		}
+		return node
+	}
+	nodes := []*corev1.Node{
+		newNode("pending", InstanceStatePending, false),
+		newNode("initializing", InstanceStateRunning, false),
+		newNode("running", InstanceStateRunning, true),
+		newNode("stopped", InstanceStateStopped, true),
+		newNode("shutting-down", InstanceStateShuttingDown, true),
+	}
+	client := fake.NewClientset()
+	d := &DriverImpl{client: client, managedNodes: map[string]corev1.Node{}}
+	for _, n := range nodes {
+		if _, err := client.CoreV1().Nodes().Create(ctx, n, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		d.managedNodes[n.Name] = *n
+	}
+	secret := &corev1.Secret{Data: map[string][]byte{
+		awsfake.AWSAccessKeyID: []byte("AKIA"), awsfake.AWSSecretAccessKey: []byte("secret"), awsfake.UserData: []byte("#!/bin/bash"),
+	}}
+	getStatus := func(machineName string) (*driver.GetMachineStatusResponse, codes.Code) {
+		resp, err := d.GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine: &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: machineName}},
+			Secret:  secret,
+		})
+		s, _ := status.FromError(err)
+		return resp, s.Code()
+	}
+	tests := []struct {
+		machineName  string
+		wantCode     codes.Code
+		wantResponse bool
+	}{
+		{"pending", codes.Uninitialized, true},
+		{"initializing", codes.Uninitialized, true},
+		{"running", codes.OK, true},
+		{"stopped", codes.Unavailable, true},
+		{"shutting-down", codes.NotFound, false},
+		{"unknown", codes.NotFound, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.machineName, func(t *testing.T) {
+			resp, code := getStatus(tc.machineName)
+			if code != tc.wantCode {
+				t.Errorf("GetMachineStatus() code = %s, want %s", code, tc.wantCode)
+			}
+			if (resp != nil) != tc.wantResponse {
+				t.Errorf("GetMachineStatus() response = %v, want response %v", resp, tc.wantResponse)
+			}
+		})
+	}
+
+	_, err := d.InitializeMachine(ctx, &driver.InitializeMachineRequest{
+		Machine: &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "initializing"}},
+		Secret:  secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, code := getStatus("initializing"); code != codes.OK {
+		t.Errorf("GetMachineStatus() after InitializeMachine code = %s, want %s", code, codes.OK)
+	}
+}
@@ -0,0 +1,159 @@
+package virtual
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// InstanceTypeCatalogPath is the path of an optional file whose instance types override or extend the embedded catalog.
+var InstanceTypeCatalogPath = "gen/instance-types.json"
+
+//go:embed instance-types.json
+var embeddedInstanceTypes []byte
+
+// DefaultMaxPods is the kubelet default for max-pods used when the instance type is unknown.
+const DefaultMaxPods = 110
+
+// InstanceType represents the hardware characteristics of a cloud instance type.
+type InstanceType struct {
+	Name         string
+	VCPU         int64
+	MemoryMiB    int64
+	GPU          int64
+	Architecture string
+	// GPUManufacturer is one of NVIDIA, AMD, Intel or Habana and determines the extended resource name of the GPUs.
+	GPUManufacturer string `json:",omitempty"`
+	GPUModel        string `json:",omitempty"`
+	// GPUFamily is the GPU family reported by the AMD node labeller, eg: AI for Instinct or NV for Navi GPUs.
+	GPUFamily    string `json:",omitempty"`
+	GPUMemoryMiB int64  `json:",omitempty"`
+	// MaxPods overrides the ENI based computation of the maximum number of pods if greater than zero.
+	MaxPods int64
+	// MaxENIs is the maximum number of elastic network interfaces that can be attached to the instance.
+	MaxENIs int64
+	// IPv4AddressesPerENI is the maximum number of private IPv4 addresses per elastic network interface.
+	IPv4AddressesPerENI int64
+	// LocalStorageGiB is the size of the instance store volumes. Zero for EBS only instances. The kubelet root
+	// filesystem lives on the root EBS volume, so this does not contribute to ephemeral-storage.
+	LocalStorageGiB int64
+}
+
+// InstanceTypeCatalog holds the known InstanceTypes keyed by their name.
+type InstanceTypeCatalog map[string]InstanceType
+
+// GetMaxPods returns the maximum number of pods for the instance type using the AWS VPC CNI formula
+// (ENIs * (IPv4 addresses per ENI - 1) + 2) unless MaxPods is explicitly set.
+func (it InstanceType) GetMaxPods() int64 {
+	if it.MaxPods > 0 {
+		return it.MaxPods
+	}
+	if it.MaxENIs > 0 && it.IPv4AddressesPerENI > 0 {
+		return it.MaxENIs*(it.IPv4AddressesPerENI-1) + 2
+	}
+	return DefaultMaxPods
+}
+
+// Capacity returns the node capacity of the instance type.
+func (it InstanceType) Capacity() corev1.ResourceList {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewQuantity(it.VCPU, resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(it.MemoryMiB*1024*1024, resource.BinarySI),
+		corev1.ResourcePods:   *resource.NewQuantity(it.GetMaxPods(), resource.DecimalSI),
+	}
+	if it.GPU > 0 {
+		capacity[ResourceGPU] = *resource.NewQuantity(it.GPU, resource.DecimalSI)
+	}
+	return capacity
+}
+
+// LoadInstanceTypeCatalog loads the embedded instance type catalog and then applies the instance types found at
+// catalogPath (if the file exists) on top of it.
+func LoadInstanceTypeCatalog(catalogPath string) (catalog InstanceTypeCatalog, err error) {
+	catalog, err = parseInstanceTypes(embeddedInstanceTypes)
+	if err != nil {
+		err = fmt.Errorf("cannot parse embedded instance type catalog: %w", err)
+		return
+	}
+	if !FileExists(catalogPath) {
+		return
+	}
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		err = fmt.Errorf("cannot read instance type catalog %q: %w", catalogPath, err)
+		return
+	}
+	overrides, err := parseInstanceTypes(data)
+	if err != nil {
+		err = fmt.Errorf("cannot parse instance type catalog %q: %w", catalogPath, err)
+		return
+	}
+	maps.Copy(catalog, overrides)
+	klog.Infof("LoadInstanceTypeCatalog applied %d instance types from %q", len(overrides), catalogPath)
+	return
+}
+
+func parseInstanceTypes(data []byte) (catalog InstanceTypeCatalog, err error) {
+	var instanceTypes []InstanceType
+	err = json.Unmarshal(data, &instanceTypes)
+	if err != nil {
+		return
+	}
+	catalog = make(InstanceTypeCatalog, len(instanceTypes))
+	for _, it := range instanceTypes {
+		if it.Name == "" {
+			err = fmt.Errorf("instance type without name: %+v", it)
+			return
+		}
+		catalog[it.Name] = it
+	}
+	return
+}
+
+// ResolveNodeTemplate returns a copy of the NodeTemplate of the given MachineClass where any missing instance type,
+// region, architecture or capacity is filled from the providerSpec and the catalog entry of the instance type.
+func (c InstanceTypeCatalog) ResolveNodeTemplate(machineClass *v1alpha1.MachineClass) (nt v1alpha1.NodeTemplate, err error) {
+	if machineClass.NodeTemplate != nil {
+		nt = *machineClass.NodeTemplate.DeepCopy()
+	}
+	if nt.InstanceType == "" || nt.Region == "" {
+		var providerSpec *awsfake.AWSProviderSpec
+		providerSpec, err = awsfake.DecodeProviderSpecAndSecret(machineClass)
+		if err != nil {
+			return
+		}
+		nt.InstanceType = cmp.Or(nt.InstanceType, providerSpec.MachineType)
+		nt.Region = cmp.Or(nt.Region, providerSpec.Region)
+	}
+	if nt.Capacity == nil {
+		nt.Capacity = make(corev1.ResourceList)
+	}
+	it, ok := c[nt.InstanceType]
+	if !ok {
+		if nt.Capacity.Cpu().IsZero() || nt.Capacity.Memory().IsZero() {
+			err = fmt.Errorf("instance type %q of MachineClass %q is not in the catalog and its NodeTemplate has no cpu/memory capacity", nt.InstanceType, machineClass.Name)
+			return
+		}
+		klog.Warningf("instance type %q of MachineClass %q is not in the catalog - using NodeTemplate as is", nt.InstanceType, machineClass.Name)
+		return
+	}
+	for name, quantity := range it.Capacity() {
+		if _, ok := nt.Capacity[name]; !ok {
+			nt.Capacity[name] = quantity
+		}
+	}
+	if nt.Architecture == nil && it.Architecture != "" {
+		arch := it.Architecture
+		nt.Architecture = &arch
+	}
+	return
+}
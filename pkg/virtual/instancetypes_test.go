@@ -0,0 +1,78 @@
+package virtual
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLoadInstanceTypeCatalogOverride(t *testing.T) {
+	catalogPath := filepath.Join(t.TempDir(), "instance-types.json")
+	err := os.WriteFile(catalogPath, []byte(`[{"Name": "m5.large", "VCPU": 2, "MemoryMiB": 8192, "MaxPods": 42}, {"Name": "x1.custom", "VCPU": 1, "MemoryMiB": 1024}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := LoadInstanceTypeCatalog(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := catalog["m5.large"].GetMaxPods(); got != 42 {
+		t.Errorf("expected overridden max pods 42 for m5.large, got %d", got)
+	}
+	if _, ok := catalog["x1.custom"]; !ok {
+		t.Errorf("expected x1.custom to be added to the catalog")
+	}
+	if got := catalog["m5.xlarge"].GetMaxPods(); got != 58 {
+		t.Errorf("expected ENI based max pods 58 for m5.xlarge, got %d", got)
+	}
+}
+
+func TestResolveNodeTemplate(t *testing.T) {
+	catalog, err := LoadInstanceTypeCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	machineClass := &v1alpha1.MachineClass{
+		ProviderSpec: runtime.RawExtension{Raw: []byte(`{"machineType": "g4dn.xlarge", "region": "eu-west-1"}`)},
+	}
+	nt, err := catalog.ResolveNodeTemplate(machineClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nt.InstanceType != "g4dn.xlarge" || nt.Region != "eu-west-1" {
+		t.Errorf("expected instance type and region from providerSpec, got %q/%q", nt.InstanceType, nt.Region)
+	}
+	if got := nt.Capacity[corev1.ResourceCPU]; got.Cmp(resource.MustParse("4")) != 0 {
+		t.Errorf("expected cpu 4, got %s", got.String())
+	}
+	if got := nt.Capacity[corev1.ResourcePods]; got.Value() != 29 {
+		t.Errorf("expected pods 29, got %s", got.String())
+	}
+	if nt.Architecture == nil || *nt.Architecture != "amd64" {
+		t.Errorf("expected architecture amd64, got %v", nt.Architecture)
+	}
+
+	machineClass.NodeTemplate = &v1alpha1.NodeTemplate{
+		InstanceType: "m5.large",
+		Region:       "eu-west-1",
+		Capacity:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3")},
+	}
+	nt, err = catalog.ResolveNodeTemplate(machineClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nt.Capacity[corev1.ResourceCPU]; got.Cmp(resource.MustParse("3")) != 0 {
+		t.Errorf("expected NodeTemplate cpu 3 to be retained, got %s", got.String())
+	}
+	if got := nt.Capacity[corev1.ResourceMemory]; got.Cmp(resource.MustParse("8Gi")) != 0 {
+		t.Errorf("expected memory 8Gi from catalog, got %s", got.String())
+	}
+	if _, ok := machineClass.NodeTemplate.Capacity[corev1.ResourceMemory]; ok {
+		t.Errorf("expected MachineClass NodeTemplate to be left unmodified")
+	}
+}
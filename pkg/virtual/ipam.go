@@ -0,0 +1,269 @@
+package virtual
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultNodesCIDR is the subnet of nodes in zones without a configured Subnet, which is the gardener default.
+	DefaultNodesCIDR = "10.250.0.0/16"
+	// DefaultPodsCIDR is the default pod range of gardener shoots from which the node pod CIDRs are allocated.
+	DefaultPodsCIDR = "100.96.0.0/11"
+	// DefaultNodeCIDRMaskSize is the default mask size of the pod CIDR of a node.
+	DefaultNodeCIDRMaskSize = 24
+
+	// subnetReservedLow and subnetReservedHigh are the number of addresses AWS reserves at the start and end of subnets.
+	subnetReservedLow  = 4
+	subnetReservedHigh = 1
+	// podCIDRReservedLow excludes the network address and the address of the bridge from pod IP assignment.
+	podCIDRReservedLow = 2
+)
+
+// ErrInsufficientFreeAddresses is returned when the subnet of a zone has no free address left for an instance.
+var ErrInsufficientFreeAddresses = errors.New("InsufficientFreeAddressesInSubnet")
+
+// NetworkConfig holds the subnets nodes are placed in and the pod range node pod CIDRs are allocated from.
+type NetworkConfig struct {
+	Subnets          []Subnet `json:",omitempty"`
+	PodsCIDR         string   `json:",omitempty"`
+	NodeCIDRMaskSize int      `json:",omitempty"`
+}
+
+// Subnet is the CIDR of the nodes of the given zone. ID optionally matches the subnetID of the network interface of
+// the providerSpec and an empty Zone matches all zones.
+type Subnet struct {
+	ID   string `json:",omitempty"`
+	Zone string `json:",omitempty"`
+	CIDR string
+}
+
+// DefaultNetworkConfig returns the NetworkConfig with a /19 subnet of the DefaultNodesCIDR for each of the given
+// zones, the way gardener lays out the worker subnets of AWS shoots. Zones beyond the 8 subnets fitting into the
+// DefaultNodesCIDR share it.
+func DefaultNetworkConfig(zones []string) NetworkConfig {
+	network := NetworkConfig{
+		PodsCIDR:         DefaultPodsCIDR,
+		NodeCIDRMaskSize: DefaultNodeCIDRMaskSize,
+	}
+	slices.Sort(zones)
+	for i, zone := range zones[:min(len(zones), 8)] {
+		network.Subnets = append(network.Subnets, Subnet{Zone: zone, CIDR: fmt.Sprintf("10.250.%d.0/19", i*32)})
+	}
+	return network
+}
+
+// GetPodsCIDR returns the PodsCIDR or the DefaultPodsCIDR if unset.
+func (n NetworkConfig) GetPodsCIDR() string {
+	return cmp.Or(n.PodsCIDR, DefaultPodsCIDR)
+}
+
+// GetNodeCIDRMaskSize returns the NodeCIDRMaskSize or the DefaultNodeCIDRMaskSize if unset.
+func (n NetworkConfig) GetNodeCIDRMaskSize() int {
+	return cmp.Or(n.NodeCIDRMaskSize, DefaultNodeCIDRMaskSize)
+}
+
+// SubnetFor returns the Subnet of an instance in the given zone launched with the given providerSpec.
+func (n NetworkConfig) SubnetFor(providerSpec *awsfake.AWSProviderSpec, zone string) Subnet {
+	if len(providerSpec.NetworkInterfaces) > 0 {
+		subnetID := providerSpec.NetworkInterfaces[0].SubnetID
+		if idx := slices.IndexFunc(n.Subnets, func(s Subnet) bool { return s.ID != "" && s.ID == subnetID }); idx >= 0 {
+			return n.Subnets[idx]
+		}
+	}
+	if idx := slices.IndexFunc(n.Subnets, func(s Subnet) bool { return s.Zone == zone }); idx >= 0 {
+		return n.Subnets[idx]
+	}
+	if idx := slices.IndexFunc(n.Subnets, func(s Subnet) bool { return s.Zone == "" }); idx >= 0 {
+		return n.Subnets[idx]
+	}
+	return Subnet{Zone: zone, CIDR: DefaultNodesCIDR}
+}
+
+// PrivateDNSName returns the EC2 private DNS name of the instance with the given private IP in the given region.
+func PrivateDNSName(ip netip.Addr, region string) string {
+	domain := region + ".compute.internal"
+	if region == "us-east-1" {
+		domain = "ec2.internal"
+	}
+	return "ip-" + strings.ReplaceAll(ip.String(), ".", "-") + "." + domain
+}
+
+// allocateNodeIP returns the lowest free address of the subnet not reserved by AWS and not used by the given nodes.
+func allocateNodeIP(subnet Subnet, nodes map[string]corev1.Node) (ip netip.Addr, err error) {
+	prefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		err = fmt.Errorf("invalid CIDR of subnet %q: %w", cmp.Or(subnet.ID, subnet.Zone), err)
+		return
+	}
+	used := make(map[netip.Addr]bool)
+	for _, n := range nodes {
+		for _, a := range initialized(n).Status.Addresses {
+			if a.Type != corev1.NodeInternalIP {
+				continue
+			}
+			if addr, err := netip.ParseAddr(a.Address); err == nil {
+				used[addr] = true
+			}
+		}
+	}
+	ip, ok := nextFreeAddr(prefix.Masked(), subnetReservedLow, subnetReservedHigh, used)
+	if !ok {
+		err = fmt.Errorf("%w: There are not enough free addresses in subnet %q (%s) to satisfy the requested number of instances", ErrInsufficientFreeAddresses, cmp.Or(subnet.ID, subnet.Zone), subnet.CIDR)
+	}
+	return
+}
+
+// allocatePodCIDR returns the lowest pod CIDR of the given mask size within the pods range not used by the given nodes.
+func allocatePodCIDR(podsCIDR string, maskSize int, nodes map[string]corev1.Node) (podCIDR netip.Prefix, err error) {
+	podsRange, err := netip.ParsePrefix(podsCIDR)
+	if err != nil {
+		err = fmt.Errorf("invalid pods CIDR: %w", err)
+		return
+	}
+	podsRange = podsRange.Masked()
+	if maskSize < podsRange.Bits() || maskSize > podsRange.Addr().BitLen() {
+		err = fmt.Errorf("node CIDR mask size %d does not fit into pods CIDR %s", maskSize, podsRange)
+		return
+	}
+	used := make(map[netip.Prefix]bool)
+	for _, n := range nodes {
+		if p, err := netip.ParsePrefix(n.Spec.PodCIDR); err == nil {
+			used[p.Masked()] = true
+		}
+	}
+	for candidate := netip.PrefixFrom(podsRange.Addr(), maskSize); podsRange.Contains(candidate.Addr()); {
+		if !used[candidate] {
+			return candidate, nil
+		}
+		next, ok := lastAddr(candidate)
+		if !ok {
+			break
+		}
+		next = next.Next()
+		if !next.IsValid() {
+			break
+		}
+		candidate = netip.PrefixFrom(next, maskSize)
+	}
+	err = fmt.Errorf("no free pod CIDR of mask size %d left in pods CIDR %s", maskSize, podsRange)
+	return
+}
+
+// assignNodeNetwork sets the addresses and pod CIDR of the node, allocating them from the given subnet and pods range.
+// As with the node IPAM controller, a node without a free pod CIDR is still created.
+func assignNodeNetwork(node *corev1.Node, subnet Subnet, network NetworkConfig, region string, nodes map[string]corev1.Node) error {
+	ip, err := allocateNodeIP(subnet, nodes)
+	if err != nil {
+		return err
+	}
+	dnsName := PrivateDNSName(ip, region)
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: ip.String()},
+		{Type: corev1.NodeInternalDNS, Address: dnsName},
+		{Type: corev1.NodeHostName, Address: dnsName},
+	}
+	podCIDR, err := allocatePodCIDR(network.GetPodsCIDR(), network.GetNodeCIDRMaskSize(), nodes)
+	if err != nil {
+		klog.Errorf("Cannot allocate pod CIDR for node %q: %v", node.Name, err)
+		return nil
+	}
+	node.Spec.PodCIDR = podCIDR.String()
+	node.Spec.PodCIDRs = []string{podCIDR.String()}
+	return nil
+}
+
+// allocatePodIP returns the lowest free address of the given pod CIDR not in use by the given pod IPs.
+func allocatePodIP(podCIDR string, used map[netip.Addr]bool) (ip netip.Addr, err error) {
+	prefix, err := netip.ParsePrefix(podCIDR)
+	if err != nil {
+		err = fmt.Errorf("invalid pod CIDR %q: %w", podCIDR, err)
+		return
+	}
+	ip, ok := nextFreeAddr(prefix.Masked(), podCIDRReservedLow, 1, used)
+	if !ok {
+		err = fmt.Errorf("no free pod IP left in pod CIDR %s", podCIDR)
+	}
+	return
+}
+
+// nextFreeAddr returns the lowest address of the prefix that is not used, skipping the given number of addresses at
+// the start and end of the prefix.
+func nextFreeAddr(prefix netip.Prefix, reservedLow, reservedHigh int, used map[netip.Addr]bool) (addr netip.Addr, ok bool) {
+	last, ok := lastAddr(prefix)
+	if !ok {
+		return
+	}
+	for range reservedHigh {
+		last = last.Prev()
+	}
+	addr = prefix.Addr()
+	for range reservedLow {
+		addr = addr.Next()
+	}
+	for ; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+		if !used[addr] {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// lastAddr returns the last address of the given masked IPv4 prefix.
+func lastAddr(prefix netip.Prefix) (addr netip.Addr, ok bool) {
+	if !prefix.Addr().Is4() {
+		return
+	}
+	a := prefix.Addr().As4()
+	hostBits := 32 - prefix.Bits()
+	n := uint32(a[0])<<24 | uint32(a[1])<<16 | uint32(a[2])<<8 | uint32(a[3])
+	if hostBits > 0 {
+		n |= 1<<hostBits - 1
+	}
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), true
+}
+
+// nodeInternalIP returns the InternalIP address of the node or an empty string if it has none.
+func nodeInternalIP(node corev1.Node) string {
+	for _, a := range node.Status.Addresses {
+		if a.Type == corev1.NodeInternalIP {
+			return a.Address
+		}
+	}
+	return ""
+}
+
+// assignPodIPs sets the host IP and pod IP of the pod the way the kubelet and CNI would. Pods not using the host
+// network get the lowest free IP of the pod CIDR of the node, given the pod IPs already used on the node.
+func assignPodIPs(pod *corev1.Pod, node corev1.Node, used map[netip.Addr]bool) error {
+	hostIP := nodeInternalIP(node)
+	if hostIP != "" {
+		pod.Status.HostIP = hostIP
+		pod.Status.HostIPs = []corev1.HostIP{{IP: hostIP}}
+	}
+	podIP := hostIP
+	if !pod.Spec.HostNetwork {
+		if node.Spec.PodCIDR == "" {
+			return nil
+		}
+		ip, err := allocatePodIP(node.Spec.PodCIDR, used)
+		if err != nil {
+			return err
+		}
+		used[ip] = true
+		podIP = ip.String()
+	}
+	if podIP != "" {
+		pod.Status.PodIP = podIP
+		pod.Status.PodIPs = []corev1.PodIP{{IP: podIP}}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package virtual
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAssignNodeNetwork(t *testing.T) {
+	network := NetworkConfig{
+		Subnets:  []Subnet{{Zone: "eu-west-1a", CIDR: "10.250.0.0/29"}},
+		PodsCIDR: "100.96.0.0/23",
+	}
+	subnet := network.SubnetFor(&awsfake.AWSProviderSpec{}, "eu-west-1a")
+	nodes := make(map[string]corev1.Node)
+	wantIPs := []string{"10.250.0.4", "10.250.0.5", "10.250.0.6"}
+	wantPodCIDRs := []string{"100.96.0.0/24", "100.96.1.0/24", ""}
+	for i, wantIP := range wantIPs {
+		node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: wantIP}}
+		if err := assignNodeNetwork(&node, subnet, network, "eu-west-1", nodes); err != nil {
+			t.Fatalf("assignNodeNetwork() err = %v", err)
+		}
+		if got := nodeInternalIP(node); got != wantIP {
+			t.Errorf("InternalIP = %s, want %s", got, wantIP)
+		}
+		if node.Spec.PodCIDR != wantPodCIDRs[i] {
+			t.Errorf("PodCIDR = %q, want %q", node.Spec.PodCIDR, wantPodCIDRs[i])
+		}
+		nodes[node.Name] = node
+	}
+	if got := nodes["10.250.0.4"].Status.Addresses[1].Address; got != "ip-10-250-0-4.eu-west-1.compute.internal" {
+		t.Errorf("InternalDNS = %s", got)
+	}
+	node := corev1.Node{}
+	if err := assignNodeNetwork(&node, subnet, network, "eu-west-1", nodes); !errors.Is(err, ErrInsufficientFreeAddresses) {
+		t.Errorf("assignNodeNetwork() err = %v, want %v", err, ErrInsufficientFreeAddresses)
+	}
+}
+
+func TestSubnetFor(t *testing.T) {
+	network := NetworkConfig{Subnets: []Subnet{
+		{ID: "subnet-1", Zone: "eu-west-1a", CIDR: "10.250.0.0/19"},
+		{Zone: "eu-west-1b", CIDR: "10.250.32.0/19"},
+		{CIDR: "10.250.64.0/19"},
+	}}
+	withSubnetID := &awsfake.AWSProviderSpec{NetworkInterfaces: []awsfake.AWSNetworkInterfaceSpec{{SubnetID: "subnet-1"}}}
+	tests := []struct {
+		name         string
+		providerSpec *awsfake.AWSProviderSpec
+		zone         string
+		wantCIDR     string
+	}{
+		{"by subnet id", withSubnetID, "eu-west-1c", "10.250.0.0/19"},
+		{"by zone", &awsfake.AWSProviderSpec{}, "eu-west-1b", "10.250.32.0/19"},
+		{"wildcard", &awsfake.AWSProviderSpec{}, "eu-west-1c", "10.250.64.0/19"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := network.SubnetFor(tc.providerSpec, tc.zone); got.CIDR != tc.wantCIDR {
+				t.Errorf("SubnetFor() = %s, want %s", got.CIDR, tc.wantCIDR)
+			}
+		})
+	}
+}
+
+func TestAssignPodIPs(t *testing.T) {
+	node := corev1.Node{
+		Spec:   corev1.NodeSpec{PodCIDR: "100.96.0.0/30"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.250.0.4"}}},
+	}
+	used := map[netip.Addr]bool{}
+	pod := corev1.Pod{}
+	if err := assignPodIPs(&pod, node, used); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Status.PodIP != "100.96.0.2" || pod.Status.HostIP != "10.250.0.4" {
+		t.Errorf("PodIP = %s, HostIP = %s", pod.Status.PodIP, pod.Status.HostIP)
+	}
+	hostNetworkPod := corev1.Pod{Spec: corev1.PodSpec{HostNetwork: true}}
+	if err := assignPodIPs(&hostNetworkPod, node, used); err != nil || hostNetworkPod.Status.PodIP != "10.250.0.4" {
+		t.Errorf("host network PodIP = %s, err = %v", hostNetworkPod.Status.PodIP, err)
+	}
+	if err := assignPodIPs(&corev1.Pod{}, node, used); err == nil {
+		t.Error("expected pod CIDR exhaustion")
+	}
+}
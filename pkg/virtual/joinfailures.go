@@ -0,0 +1,49 @@
+package virtual
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"k8s.io/klog/v2"
+)
+
+// AnnotationJoinFailure marks a node whose kubelet is simulated to never become Ready.
+const AnnotationJoinFailure = "virtual.gardener.cloud/join-failure"
+
+const (
+	// JoinFailureNoNode simulates an instance whose kubelet never registers a node.
+	JoinFailureNoNode = "NoNode"
+	// JoinFailureNotReady simulates an instance whose node registers but never becomes Ready.
+	JoinFailureNotReady = "NotReady"
+)
+
+// JoinFailure makes the given fraction of the instances created for the MachineClass and Zone fail to join the cluster
+// as per the Mode, which is either JoinFailureNoNode (the default) or JoinFailureNotReady. An empty MachineClass or
+// Zone matches all.
+type JoinFailure struct {
+	MachineClass string `json:",omitempty"`
+	Zone         string `json:",omitempty"`
+	Probability  float64
+	Mode         string `json:",omitempty"`
+}
+
+// joinFailureMode returns the mode of the join failure simulated for an instance of the given MachineClass in the
+// given zone as per the first matching JoinFailure, or an empty string if the instance joins.
+func (s SimulationConfig) joinFailureMode(machineClassName, zone string) string {
+	idx := slices.IndexFunc(s.JoinFailures, func(jf JoinFailure) bool {
+		return (jf.MachineClass == "" || jf.MachineClass == machineClassName) && (jf.Zone == "" || jf.Zone == zone)
+	})
+	if idx < 0 {
+		return ""
+	}
+	jf := s.JoinFailures[idx]
+	if rand.Float64() >= jf.Probability {
+		return ""
+	}
+	mode := jf.Mode
+	if mode == "" {
+		mode = JoinFailureNoNode
+	}
+	klog.Warningf("Simulating join failure %q for instance of MachineClass %q in zone %q", mode, machineClassName, zone)
+	return mode
+}
@@ -0,0 +1,69 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJoinFailureMode(t *testing.T) {
+	s := SimulationConfig{JoinFailures: []JoinFailure{
+		{MachineClass: "class-a", Zone: "eu-west-1a", Probability: 1, Mode: JoinFailureNotReady},
+		{Zone: "eu-west-1b", Probability: 1},
+		{MachineClass: "class-c", Probability: 0},
+	}}
+	tests := []struct {
+		machineClass, zone, wantMode string
+	}{
+		{"class-a", "eu-west-1a", JoinFailureNotReady},
+		{"class-b", "eu-west-1a", ""},
+		{"class-a", "eu-west-1b", JoinFailureNoNode},
+		{"class-c", "eu-west-1c", ""},
+	}
+	for _, tc := range tests {
+		if got := s.joinFailureMode(tc.machineClass, tc.zone); got != tc.wantMode {
+			t.Errorf("joinFailureMode(%q, %q) = %q, want %q", tc.machineClass, tc.zone, got, tc.wantMode)
+		}
+	}
+}
+
+func TestDeleteUnjoinedInstance(t *testing.T) {
+	ctx := context.Background()
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "m1", Labels: map[string]string{LabelMachineName: "m1"}, Annotations: map[string]string{}}}
+	d := &DriverImpl{
+		client:            fake.NewClientset(),
+		managedNodes:      map[string]corev1.Node{},
+		unjoinedInstances: map[string]corev1.Node{node.Name: node},
+		simConfig:         SimulationConfig{InstanceDelays: InstanceDelays{DeleteMin: 3600, DeleteMax: 3600}},
+	}
+	if err := d.reloadNodes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.nodeForMachine("m1"); !ok {
+		t.Fatal("expected unjoined instance to be part of the managed nodes")
+	}
+	_, err := d.DeleteMachine(ctx, &driver.DeleteMachineRequest{
+		Machine: &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "m1"}},
+		Secret: &corev1.Secret{Data: map[string][]byte{
+			awsfake.AWSAccessKeyID: []byte("AKIA"), awsfake.AWSSecretAccessKey: []byte("secret"), awsfake.UserData: []byte("#!/bin/bash"),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStateOf(d.managedNodes["m1"]); got != InstanceStateShuttingDown {
+		t.Errorf("instance state = %q, want %q", got, InstanceStateShuttingDown)
+	}
+	if err = d.terminateInstance(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.nodeForMachine("m1"); ok {
+		t.Error("expected terminated unjoined instance to be gone")
+	}
+}
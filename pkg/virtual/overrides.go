@@ -0,0 +1,257 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	rand "math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// AnnotationMachineDeployment is the node annotation holding the name of the MachineDeployment of the machine of the
+// node, which matches SimulationOverrides for the instance of the node after its creation.
+const AnnotationMachineDeployment = "virtual.gardener.cloud/machine-deployment"
+
+// SimulationOverride overrides the SimulationConfig for the instances matching all of its set MachineClass,
+// MachineDeployment, Selector and InstanceType. The Selector matches the labels of the NodeTemplateSpec of the machine.
+// Overrides apply in order, so later overrides take precedence over earlier ones.
+type SimulationOverride struct {
+	// Name identifies the override in logs.
+	Name              string                `json:",omitempty"`
+	MachineClass      string                `json:",omitempty"`
+	MachineDeployment string                `json:",omitempty"`
+	Selector          *metav1.LabelSelector `json:",omitempty"`
+	InstanceType      string                `json:",omitempty"`
+
+	// InstanceDelays overrides the delays whose minimum or maximum is set.
+	InstanceDelays               *InstanceDelays `json:",omitempty"`
+	DuplicateInstanceProbability *float64        `json:",omitempty"`
+	StuckTerminationProbability  *float64        `json:",omitempty"`
+	// JoinFailure takes precedence over the JoinFailures of the SimulationConfig.
+	JoinFailure   *JoinFailure   `json:",omitempty"`
+	StartupTaints []StartupTaint `json:",omitempty"`
+	Spot          *SpotConfig    `json:",omitempty"`
+}
+
+// SpotConfig simulates spot instances, whose providerSpec sets a SpotPrice. They fail to launch with
+// InsufficientInstanceCapacity with the given InsufficientCapacityProbability and are interrupted with the given
+// InterruptionProbability after a random delay in seconds between InterruptionDelayMin and InterruptionDelayMax, which
+// terminates them.
+type SpotConfig struct {
+	InsufficientCapacityProbability float64 `json:",omitempty"`
+	InterruptionProbability         float64 `json:",omitempty"`
+	InterruptionDelayMin            int64   `json:",omitempty"`
+	InterruptionDelayMax            int64   `json:",omitempty"`
+}
+
+// OverrideTarget identifies the instance SimulationOverrides are matched against.
+type OverrideTarget struct {
+	MachineClass      string
+	MachineDeployment string
+	Labels            map[string]string
+	InstanceType      string
+}
+
+// overrideTargetOf returns the OverrideTarget of a machine of the given MachineClass with the given instance type.
+func overrideTargetOf(machine *v1alpha1.Machine, machineClassName, instanceType string) OverrideTarget {
+	return OverrideTarget{
+		MachineClass:      machineClassName,
+		MachineDeployment: machineDeploymentOf(machine),
+		Labels:            machine.Spec.NodeTemplateSpec.Labels,
+		InstanceType:      instanceType,
+	}
+}
+
+// nodeOverrideTarget returns the OverrideTarget of the instance of the given node.
+func nodeOverrideTarget(node corev1.Node) OverrideTarget {
+	tags, _ := instanceTagsOf(node)
+	node = initialized(node)
+	return OverrideTarget{
+		MachineClass:      tags[TagMachineClass],
+		MachineDeployment: node.Annotations[AnnotationMachineDeployment],
+		Labels:            node.Labels,
+		InstanceType:      node.Labels[corev1.LabelInstanceTypeStable],
+	}
+}
+
+// machineDeploymentOf returns the name of the MachineDeployment of the given machine, which is the name of its
+// MachineSet without the template hash suffix.
+func machineDeploymentOf(machine *v1alpha1.Machine) string {
+	for _, ref := range machine.OwnerReferences {
+		if ref.Kind != "MachineSet" {
+			continue
+		}
+		if idx := strings.LastIndex(ref.Name, "-"); idx > 0 {
+			return ref.Name[:idx]
+		}
+	}
+	return ""
+}
+
+func (o SimulationOverride) matches(target OverrideTarget) bool {
+	if o.MachineClass != "" && o.MachineClass != target.MachineClass {
+		return false
+	}
+	if o.MachineDeployment != "" && o.MachineDeployment != target.MachineDeployment {
+		return false
+	}
+	if o.InstanceType != "" && o.InstanceType != target.InstanceType {
+		return false
+	}
+	if o.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(o.Selector)
+		if err != nil || !selector.Matches(labels.Set(target.Labels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// For returns the SimulationConfig for the given OverrideTarget, which has the matching Overrides applied.
+func (s SimulationConfig) For(target OverrideTarget) SimulationConfig {
+	effective := s
+	for _, o := range s.Overrides {
+		if !o.matches(target) {
+			continue
+		}
+		klog.V(4).Infof("Applying SimulationOverride %q to instance of MachineClass %q", o.Name, target.MachineClass)
+		if o.InstanceDelays != nil {
+			effective.InstanceDelays = o.InstanceDelays.overlay(effective.InstanceDelays)
+		}
+		if o.DuplicateInstanceProbability != nil {
+			effective.DuplicateInstanceProbability = *o.DuplicateInstanceProbability
+		}
+		if o.StuckTerminationProbability != nil {
+			effective.StuckTerminationProbability = *o.StuckTerminationProbability
+		}
+		if o.JoinFailure != nil {
+			effective.JoinFailures = append([]JoinFailure{*o.JoinFailure}, effective.JoinFailures...)
+		}
+		if o.StartupTaints != nil {
+			effective.StartupTaints = o.StartupTaints
+		}
+		if o.Spot != nil {
+			effective.Spot = o.Spot
+		}
+	}
+	return effective
+}
+
+// overlay returns the given InstanceDelays with the delays of these InstanceDelays whose minimum or maximum is set.
+func (o InstanceDelays) overlay(base InstanceDelays) InstanceDelays {
+	defaultDelay(&o.CreateMin, &o.CreateMax, base.CreateMin, base.CreateMax)
+	defaultDelay(&o.InitializeMin, &o.InitializeMax, base.InitializeMin, base.InitializeMax)
+	defaultDelay(&o.JoinMin, &o.JoinMax, base.JoinMin, base.JoinMax)
+	defaultDelay(&o.DeleteMin, &o.DeleteMax, base.DeleteMin, base.DeleteMax)
+	defaultDelay(&o.RebootMin, &o.RebootMax, base.RebootMin, base.RebootMax)
+	return o
+}
+
+// spotConfigFor returns the Spot config of the SimulationConfig if the given providerSpec requests a spot instance by
+// setting a SpotPrice, or else nil as on-demand instances are neither short of spot capacity nor interrupted.
+func (s SimulationConfig) spotConfigFor(providerSpec *awsfake.AWSProviderSpec) *SpotConfig {
+	if providerSpec.SpotPrice == nil {
+		return nil
+	}
+	return s.Spot
+}
+
+// simulateInsufficientCapacity reports whether the launch of a spot instance fails for lack of spot capacity.
+func (c *SpotConfig) simulateInsufficientCapacity() bool {
+	return c != nil && rand.Float64() < c.InsufficientCapacityProbability
+}
+
+// interruptionDelay returns the delay after which a spot instance is interrupted and whether it is interrupted at all.
+func (c *SpotConfig) interruptionDelay() (delay time.Duration, ok bool) {
+	if c == nil || rand.Float64() >= c.InterruptionProbability {
+		return
+	}
+	return randomDuration(c.InterruptionDelayMin, c.InterruptionDelayMax), true
+}
+
+// scheduleSpotInterruption interrupts the spot instance of the given node after the given delay, which shuts it down
+// and terminates it like a retirement.
+func (d *DriverImpl) scheduleSpotInterruption(nodeName string, delay time.Duration) {
+	klog.Infof("Interrupting spot instance of node %q after %s", nodeName, delay)
+	time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		node, unjoined := d.unjoinedInstances[nodeName]
+		if !unjoined {
+			n, err := d.client.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				klog.Infof("Node %q is gone - not interrupting its spot instance", nodeName)
+				return
+			}
+			if err != nil {
+				klog.Errorf("Failed to get node %q to interrupt its spot instance: %v", nodeName, err)
+				return
+			}
+			node = *n
+		}
+		if state := instanceStateOf(node); state != InstanceStateRunning {
+			klog.Infof("Spot instance of node %q is %s - not interrupting it", nodeName, state)
+			return
+		}
+		klog.Warningf("Simulating interruption of spot instance %q of node %q", node.Spec.ProviderID, nodeName)
+		err := d.triggerInstanceEvent(context.Background(), node, InstanceEventRetirement)
+		if err != nil {
+			klog.Errorf("Failed to interrupt spot instance of node %q: %v", nodeName, err)
+		}
+	})
+}
+
+func validateOverrides(overrides []SimulationOverride, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, o := range overrides {
+		idxPath := fldPath.Index(i)
+		if o.MachineClass == "" && o.MachineDeployment == "" && o.Selector == nil && o.InstanceType == "" {
+			allErrs = append(allErrs, field.Required(idxPath, "one of MachineClass, MachineDeployment, Selector or InstanceType is required"))
+		}
+		if o.Selector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(o.Selector); err != nil {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("Selector"), o.Selector, err.Error()))
+			}
+		}
+		if o.InstanceDelays != nil {
+			allErrs = append(allErrs, validateInstanceDelays(o.InstanceDelays.overlay(InstanceDelays{}), idxPath.Child("InstanceDelays"))...)
+		}
+		if o.DuplicateInstanceProbability != nil {
+			allErrs = append(allErrs, validateProbability(*o.DuplicateInstanceProbability, idxPath.Child("DuplicateInstanceProbability"))...)
+		}
+		if o.StuckTerminationProbability != nil {
+			allErrs = append(allErrs, validateProbability(*o.StuckTerminationProbability, idxPath.Child("StuckTerminationProbability"))...)
+		}
+		if o.JoinFailure != nil {
+			allErrs = append(allErrs, validateJoinFailures([]JoinFailure{*o.JoinFailure}, idxPath.Child("JoinFailure"))...)
+		}
+		allErrs = append(allErrs, validateStartupTaints(o.StartupTaints, idxPath.Child("StartupTaints"))...)
+		allErrs = append(allErrs, validateSpotConfig(o.Spot, idxPath.Child("Spot"))...)
+	}
+	return allErrs
+}
+
+func validateSpotConfig(spot *SpotConfig, fldPath *field.Path) field.ErrorList {
+	if spot == nil {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validateProbability(spot.InsufficientCapacityProbability, fldPath.Child("InsufficientCapacityProbability"))...)
+	allErrs = append(allErrs, validateProbability(spot.InterruptionProbability, fldPath.Child("InterruptionProbability"))...)
+	allErrs = append(allErrs, validateDelay(spot.InterruptionDelayMin, spot.InterruptionDelayMax, fldPath.Child("InterruptionDelayMin"), fldPath.Child("InterruptionDelayMax"))...)
+	return allErrs
+}
+
+// insufficientCapacityMessage is the message of the InsufficientInstanceCapacity error of EC2.
+func insufficientCapacityMessage(instanceType, zone string) string {
+	return fmt.Sprintf("InsufficientInstanceCapacity: We currently do not have sufficient %s capacity in the Availability Zone you requested (%s).", instanceType, zone)
+}
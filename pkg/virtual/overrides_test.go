@@ -0,0 +1,95 @@
+package virtual
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestSimulationConfigFor(t *testing.T) {
+	s := SimulationConfig{
+		InstanceDelays: InstanceDelays{CreateMin: 1, CreateMax: 2, JoinMin: 2, JoinMax: 4},
+		JoinFailures:   []JoinFailure{{Probability: 0.1}},
+		Overrides: []SimulationOverride{
+			{
+				Name:           "slow-gpu",
+				Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"worker.gardener.cloud/pool": "gpu"}},
+				InstanceDelays: &InstanceDelays{JoinMin: 60, JoinMax: 120},
+				JoinFailure:    &JoinFailure{Probability: 1, Mode: JoinFailureNotReady},
+			},
+			{
+				Name:                        "spot",
+				MachineDeployment:           "shoot--p--s-spot-z1",
+				InstanceType:                "m5.large",
+				StuckTerminationProbability: ptr.To(0.5),
+				Spot:                        &SpotConfig{InterruptionProbability: 1, InterruptionDelayMin: 10, InterruptionDelayMax: 20},
+			},
+		},
+	}
+	gpu := s.For(OverrideTarget{MachineClass: "gpu-class", Labels: map[string]string{"worker.gardener.cloud/pool": "gpu"}, InstanceType: "p3.2xlarge"})
+	if want := (InstanceDelays{CreateMin: 1, CreateMax: 2, JoinMin: 60, JoinMax: 120}); gpu.InstanceDelays != want {
+		t.Errorf("InstanceDelays of gpu pool = %+v, want %+v", gpu.InstanceDelays, want)
+	}
+	if got := gpu.joinFailureMode("gpu-class", "eu-west-1a"); got != JoinFailureNotReady {
+		t.Errorf("joinFailureMode() of gpu pool = %q, want %q", got, JoinFailureNotReady)
+	}
+	if gpu.Spot != nil || gpu.StuckTerminationProbability != 0 {
+		t.Errorf("expected spot override not to apply to gpu pool, got %+v", gpu)
+	}
+
+	spot := s.For(OverrideTarget{MachineDeployment: "shoot--p--s-spot-z1", InstanceType: "m5.large"})
+	if spot.Spot == nil || spot.StuckTerminationProbability != 0.5 || spot.InstanceDelays != s.InstanceDelays {
+		t.Errorf("SimulationConfig of spot pool = %+v", spot)
+	}
+	if delay, ok := spot.Spot.interruptionDelay(); !ok || delay.Seconds() < 10 || delay.Seconds() > 20 {
+		t.Errorf("interruptionDelay() = %s, %v, want between 10s and 20s", delay, ok)
+	}
+	if other := s.For(OverrideTarget{MachineDeployment: "shoot--p--s-spot-z1", InstanceType: "m5.xlarge"}); other.Spot != nil {
+		t.Error("expected spot override to require all of its criteria to match")
+	}
+	if len(s.JoinFailures) != 1 {
+		t.Errorf("expected For() to leave the SimulationConfig unchanged, got JoinFailures %v", s.JoinFailures)
+	}
+}
+
+func TestMachineDeploymentOf(t *testing.T) {
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{Kind: "MachineSet", Name: "shoot--p--s-cpu-z1-5d8f9"}},
+	}}
+	if got := machineDeploymentOf(machine); got != "shoot--p--s-cpu-z1" {
+		t.Errorf("machineDeploymentOf() = %q, want %q", got, "shoot--p--s-cpu-z1")
+	}
+	if got := machineDeploymentOf(&v1alpha1.Machine{}); got != "" {
+		t.Errorf("machineDeploymentOf() of machine without MachineSet = %q, want empty", got)
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	overrides := []SimulationOverride{
+		{InstanceDelays: &InstanceDelays{JoinMin: 1}},
+		{MachineClass: "c", InstanceDelays: &InstanceDelays{JoinMin: 5, JoinMax: 1}, Spot: &SpotConfig{InterruptionProbability: 2}},
+		{Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "k", Operator: "Near"}}}},
+	}
+	var got []string
+	for _, err := range validateOverrides(overrides, nil) {
+		got = append(got, err.Field)
+	}
+	want := []string{"[0]", "[1].InstanceDelays.JoinMax", "[1].Spot.InterruptionProbability", "[2].Selector"}
+	if !slices.Equal(got, want) {
+		t.Errorf("validateOverrides() errors on %v, want %v", got, want)
+	}
+}
+
+func TestSpotConfigFor(t *testing.T) {
+	s := SimulationConfig{Spot: &SpotConfig{InsufficientCapacityProbability: 1, InterruptionProbability: 1}}
+	if got := s.spotConfigFor(&awsfake.AWSProviderSpec{}); got != nil || got.simulateInsufficientCapacity() {
+		t.Errorf("spotConfigFor() of on-demand instance = %+v, want nil", got)
+	}
+	if got := s.spotConfigFor(&awsfake.AWSProviderSpec{SpotPrice: ptr.To("")}); got != s.Spot || !got.simulateInsufficientCapacity() {
+		t.Errorf("spotConfigFor() of spot instance = %+v, want %+v", got, s.Spot)
+	}
+}
@@ -0,0 +1,193 @@
+package virtual
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	machineinformers "github.com/gardener/machine-controller-manager/pkg/client/informers/externalversions"
+	machinelisters "github.com/gardener/machine-controller-manager/pkg/client/listers/machine/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SimulationConfigQuotasKey is the key of the SimulationConfig ConfigMap holding the YAML list of the quotas synced
+	// from the MachineClasses. Quotas of the SimulationConfig take precedence over synced quotas of the same instance
+	// type and region.
+	SimulationConfigQuotasKey = "machine-class-quotas.yaml"
+
+	// DefaultQuotaAmount is the amount of the quotas synced from MachineClasses if QuotaSyncConfig.DefaultAmount is unset.
+	DefaultQuotaAmount = 10
+
+	// QuotaRemovalPolicyKeep keeps the synced quotas of instance types and regions no MachineClass uses anymore.
+	QuotaRemovalPolicyKeep = "Keep"
+	// QuotaRemovalPolicyRemove removes the synced quotas of instance types and regions no MachineClass uses anymore.
+	QuotaRemovalPolicyRemove = "Remove"
+)
+
+// QuotaSyncConfig configures the quotas synced from the MachineClasses, which get a quota of the DefaultAmount for
+// each new instance type and region. The RemovalPolicy, which is either QuotaRemovalPolicyKeep (the default) or
+// QuotaRemovalPolicyRemove, decides about the synced quotas of removed MachineClasses.
+type QuotaSyncConfig struct {
+	Disabled      bool   `json:",omitempty"`
+	DefaultAmount int    `json:",omitempty"`
+	RemovalPolicy string `json:",omitempty"`
+}
+
+// GetDefaultAmount returns the DefaultAmount or the DefaultQuotaAmount if unset.
+func (c QuotaSyncConfig) GetDefaultAmount() int {
+	return cmp.Or(c.DefaultAmount, DefaultQuotaAmount)
+}
+
+// machineClassQuotas returns the quotas of the given MachineClasses with the given amount, one per instance type and
+// region, sorted by region and instance type. MachineClasses without NodeTemplate are skipped.
+func machineClassQuotas(machineClasses []*v1alpha1.MachineClass, amount int) (quotas []Quota) {
+	for _, mc := range machineClasses {
+		if mc.NodeTemplate == nil {
+			klog.Warningf("MachineClass %q has no NodeTemplate - skipping its quota", mc.Name)
+			continue
+		}
+		q := Quota{MachineType: mc.NodeTemplate.InstanceType, Region: mc.NodeTemplate.Region, Amount: amount}
+		if !slices.ContainsFunc(quotas, q.sameKey) {
+			quotas = append(quotas, q)
+		}
+	}
+	sortQuotas(quotas)
+	return
+}
+
+// syncQuotas returns the given synced quotas with a quota of the DefaultAmount for each instance type and region of the
+// given MachineClasses lacking one. Synced quotas of instance types and regions without MachineClass are dropped if the
+// RemovalPolicy is QuotaRemovalPolicyRemove.
+func syncQuotas(synced []Quota, machineClasses []*v1alpha1.MachineClass, config QuotaSyncConfig) []Quota {
+	used := machineClassQuotas(machineClasses, config.GetDefaultAmount())
+	result := slices.Clone(synced)
+	if config.RemovalPolicy == QuotaRemovalPolicyRemove {
+		result = slices.DeleteFunc(result, func(q Quota) bool {
+			return !slices.ContainsFunc(used, q.sameKey)
+		})
+	}
+	for _, q := range used {
+		if !slices.ContainsFunc(result, q.sameKey) {
+			result = append(result, q)
+		}
+	}
+	sortQuotas(result)
+	return result
+}
+
+// mergeQuotas returns the given quotas followed by the synced quotas of instance types and regions without quota.
+func mergeQuotas(quotas, synced []Quota) []Quota {
+	merged := slices.Clone(quotas)
+	for _, q := range synced {
+		if !slices.ContainsFunc(quotas, q.sameKey) {
+			merged = append(merged, q)
+		}
+	}
+	return merged
+}
+
+func (q Quota) sameKey(other Quota) bool {
+	return q.MachineType == other.MachineType && q.Region == other.Region
+}
+
+func sortQuotas(quotas []Quota) {
+	slices.SortFunc(quotas, func(a, b Quota) int {
+		return cmp.Or(cmp.Compare(a.Region, b.Region), cmp.Compare(a.MachineType, b.MachineType))
+	})
+}
+
+// watchMachineClasses syncs the quotas of the SimulationConfig ConfigMap whenever a MachineClass of the shoot
+// namespace is added, changed or removed until the context is done.
+func (d *DriverImpl) watchMachineClasses(ctx context.Context) {
+	factory := machineinformers.NewSharedInformerFactoryWithOptions(d.machineClient, 0, machineinformers.WithNamespace(d.shootNamespace))
+	informer := factory.Machine().V1alpha1().MachineClasses()
+	lister := informer.Lister()
+	onChange := func(any) {
+		if !informer.Informer().HasSynced() {
+			return
+		}
+		err := d.syncMachineClassQuotas(ctx, lister)
+		if err != nil {
+			klog.Errorf("watchMachineClasses cannot sync quotas: %v", err)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(_, obj any) { onChange(obj) },
+		DeleteFunc: onChange,
+	})
+	if err != nil {
+		klog.Errorf("watchMachineClasses cannot watch MachineClasses: %v", err)
+		return
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return
+	}
+	onChange(nil)
+}
+
+// syncMachineClassQuotas updates the synced quotas of the SimulationConfig ConfigMap as per the MachineClasses of the
+// given lister.
+func (d *DriverImpl) syncMachineClassQuotas(ctx context.Context, lister machinelisters.MachineClassLister) error {
+	d.mu.Lock()
+	config := d.simConfig.QuotaSync
+	d.mu.Unlock()
+	if config.Disabled {
+		return nil
+	}
+	machineClasses, err := lister.MachineClasses(d.shootNamespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := d.client.CoreV1().ConfigMaps(d.shootNamespace).Get(ctx, SimulationConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		var synced []Quota
+		if data, ok := cm.Data[SimulationConfigQuotasKey]; ok {
+			if err = yaml.Unmarshal([]byte(data), &synced); err != nil {
+				return fmt.Errorf("cannot decode %q of ConfigMap %s/%s: %w", SimulationConfigQuotasKey, cm.Namespace, cm.Name, err)
+			}
+		}
+		updated := syncQuotas(synced, machineClasses, config)
+		if _, ok := cm.Data[SimulationConfigQuotasKey]; ok && slices.Equal(updated, synced) {
+			return nil
+		}
+		data, err := yaml.Marshal(updated)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[SimulationConfigQuotasKey] = string(data)
+		_, err = d.client.CoreV1().ConfigMaps(d.shootNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+		if err == nil {
+			klog.Infof("Synced quotas of %d MachineClasses to ConfigMap %s/%s: %v", len(machineClasses), cm.Namespace, cm.Name, updated)
+		}
+		return err
+	})
+}
+
+func validateQuotaSync(config QuotaSyncConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if config.DefaultAmount < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("DefaultAmount"), config.DefaultAmount, "must not be negative"))
+	}
+	validPolicies := []string{QuotaRemovalPolicyKeep, QuotaRemovalPolicyRemove}
+	if config.RemovalPolicy != "" && !slices.Contains(validPolicies, config.RemovalPolicy) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("RemovalPolicy"), config.RemovalPolicy, validPolicies))
+	}
+	return allErrs
+}
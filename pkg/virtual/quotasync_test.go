@@ -0,0 +1,159 @@
+package virtual
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	mcmfake "github.com/gardener/machine-controller-manager/pkg/client/clientset/versioned/fake"
+	machinelisters "github.com/gardener/machine-controller-manager/pkg/client/listers/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+func newMachineClass(name, instanceType, region string) *v1alpha1.MachineClass {
+	return &v1alpha1.MachineClass{
+		ObjectMeta:   metav1.ObjectMeta{Name: name, Namespace: "shoot--p--s"},
+		NodeTemplate: &v1alpha1.NodeTemplate{InstanceType: instanceType, Region: region, Zone: region + "a"},
+	}
+}
+
+func TestSyncQuotas(t *testing.T) {
+	classes := []*v1alpha1.MachineClass{
+		newMachineClass("a", "m5.large", "eu-west-1"),
+		newMachineClass("b", "m5.large", "eu-west-1"),
+		newMachineClass("c", "c5.xlarge", "eu-central-1"),
+		{ObjectMeta: metav1.ObjectMeta{Name: "no-template"}},
+	}
+	synced := []Quota{
+		{MachineType: "m5.large", Region: "eu-west-1", Amount: 3},
+		{MachineType: "p3.2xlarge", Region: "eu-west-1", Amount: 1},
+	}
+
+	got := syncQuotas(synced, classes, QuotaSyncConfig{DefaultAmount: 5})
+	want := []Quota{
+		{MachineType: "c5.xlarge", Region: "eu-central-1", Amount: 5},
+		{MachineType: "m5.large", Region: "eu-west-1", Amount: 3},
+		{MachineType: "p3.2xlarge", Region: "eu-west-1", Amount: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("syncQuotas() with Keep = %v, want %v", got, want)
+	}
+
+	got = syncQuotas(synced, classes, QuotaSyncConfig{RemovalPolicy: QuotaRemovalPolicyRemove})
+	want = []Quota{
+		{MachineType: "c5.xlarge", Region: "eu-central-1", Amount: DefaultQuotaAmount},
+		{MachineType: "m5.large", Region: "eu-west-1", Amount: 3},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("syncQuotas() with Remove = %v, want %v", got, want)
+	}
+	if len(synced) != 2 || synced[1].MachineType != "p3.2xlarge" {
+		t.Errorf("expected syncQuotas() to leave the synced quotas unchanged, got %v", synced)
+	}
+}
+
+func TestMergeQuotas(t *testing.T) {
+	quotas := []Quota{{MachineType: "m5.large", Region: "eu-west-1", Amount: 1}}
+	synced := []Quota{
+		{MachineType: "m5.large", Region: "eu-west-1", Amount: 10},
+		{MachineType: "m5.large", Region: "eu-central-1", Amount: 10},
+	}
+	got := mergeQuotas(quotas, synced)
+	want := []Quota{quotas[0], synced[1]}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeQuotas() = %v, want %v", got, want)
+	}
+}
+
+func TestSyncMachineClassQuotas(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: SimulationConfigMapName, Namespace: "shoot--p--s"},
+		Data:       map[string]string{SimulationConfigYAMLKey: "apiVersion: virtual.gardener.cloud/v1alpha1\n"},
+	}
+	mc := newMachineClass("a", "m5.large", "eu-west-1")
+	d := &DriverImpl{
+		client:         fake.NewClientset(cm),
+		machineClient:  mcmfake.NewSimpleClientset(mc),
+		shootNamespace: "shoot--p--s",
+		simConfig:      SimulationConfig{QuotaSync: QuotaSyncConfig{DefaultAmount: 2}},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(mc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.syncMachineClassQuotas(ctx, machinelisters.NewMachineClassLister(indexer)); err != nil {
+		t.Fatalf("syncMachineClassQuotas() err = %v", err)
+	}
+	cm, err := d.client.CoreV1().ConfigMaps(cm.Namespace).Get(ctx, cm.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var synced []Quota
+	if err = yaml.Unmarshal([]byte(cm.Data[SimulationConfigQuotasKey]), &synced); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Quota{{MachineType: "m5.large", Region: "eu-west-1", Amount: 2}}; !slices.Equal(synced, want) {
+		t.Errorf("synced quotas = %v, want %v", synced, want)
+	}
+
+	if err = d.applySimulationConfigMap(cm); err != nil {
+		t.Fatalf("applySimulationConfigMap() err = %v", err)
+	}
+	if len(d.simConfig.Quotas) != 1 || d.simConfig.Quotas[0].Amount != 2 {
+		t.Errorf("expected synced quotas to be applied, got %v", d.simConfig.Quotas)
+	}
+}
+
+func TestValidateQuotaSync(t *testing.T) {
+	var got []string
+	for _, err := range validateQuotaSync(QuotaSyncConfig{DefaultAmount: -1, RemovalPolicy: "Delete"}, nil) {
+		got = append(got, err.Field)
+	}
+	if want := []string{"DefaultAmount", "RemovalPolicy"}; !slices.Equal(got, want) {
+		t.Errorf("validateQuotaSync() errors on %v, want %v", got, want)
+	}
+}
+
+func TestCreateSimulationConfigSyncsQuotasAsSeeded(t *testing.T) {
+	ctx := context.Background()
+	defer func(path string) { SimulationConfigPath = path }(SimulationConfigPath)
+	SimulationConfigPath = filepath.Join(t.TempDir(), "simulation-config.yaml")
+	for _, tc := range []struct {
+		name       string
+		seed       string
+		wantQuotas string
+	}{
+		{"configured amount", "apiVersion: virtual.gardener.cloud/v1alpha1\nQuotaSync:\n  DefaultAmount: 3\n", "- Amount: 3\n  MachineType: m5.large\n  Region: eu-west-1\n"},
+		{"disabled", "apiVersion: virtual.gardener.cloud/v1alpha1\nQuotaSync:\n  Disabled: true\n", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(SimulationConfigPath, []byte(tc.seed), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			d := &DriverImpl{
+				client:         fake.NewClientset(),
+				machineClient:  mcmfake.NewSimpleClientset(newMachineClass("a", "m5.large", "eu-west-1")),
+				shootNamespace: "shoot--p--s",
+			}
+			if err := d.createSimulationConfig(ctx); err != nil {
+				t.Fatalf("createSimulationConfig() err = %v", err)
+			}
+			cm, err := d.client.CoreV1().ConfigMaps("shoot--p--s").Get(ctx, SimulationConfigMapName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cm.Data[SimulationConfigQuotasKey]; got != tc.wantQuotas {
+				t.Errorf("synced quotas = %q, want %q", got, tc.wantQuotas)
+			}
+		})
+	}
+}
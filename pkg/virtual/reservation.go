@@ -0,0 +1,216 @@
+package virtual
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// KubeletConfigPath is the path of the kubelet reservation overrides generated by `dev setup` from the shoot spec.
+var KubeletConfigPath = "gen/kubelet-config.json"
+
+const (
+	// LabelWorkerPool is the node label carrying the name of the gardener worker pool.
+	LabelWorkerPool = "worker.gardener.cloud/pool"
+
+	EvictionSignalMemoryAvailable = "memory.available"
+	EvictionSignalNodeFSAvailable = "nodefs.available"
+)
+
+// DefaultEvictionHard holds the hard eviction thresholds gardener configures for the kubelet.
+var DefaultEvictionHard = map[string]string{
+	EvictionSignalMemoryAvailable: "100Mi",
+	EvictionSignalNodeFSAvailable: "5%",
+}
+
+// KubeletConfig holds the kubelet resource reservations of the shoot. Default applies to all worker pools
+// and Pools holds the overrides keyed by worker pool name.
+type KubeletConfig struct {
+	Default KubeletReservation
+	Pools   map[string]KubeletReservation `json:",omitempty"`
+	// Version is the kubernetes version of the shoot and PoolVersions holds the versions of worker pools with a
+	// kubernetes version differing from the shoot.
+	Version      string            `json:",omitempty"`
+	PoolVersions map[string]string `json:",omitempty"`
+}
+
+// VersionForPool returns the kubelet version of the given worker pool.
+func (kc KubeletConfig) VersionForPool(poolName string) string {
+	if v, ok := kc.PoolVersions[poolName]; ok {
+		return v
+	}
+	return kc.Version
+}
+
+// KubeletReservation holds the kube-reserved, system-reserved and hard eviction thresholds of a kubelet.
+// Resources missing from KubeReserved are computed from the node capacity the way gardener does.
+type KubeletReservation struct {
+	KubeReserved   corev1.ResourceList `json:",omitempty"`
+	SystemReserved corev1.ResourceList `json:",omitempty"`
+	// EvictionHard maps eviction signals like memory.available to a quantity or percentage.
+	EvictionHard map[string]string `json:",omitempty"`
+}
+
+// LoadKubeletConfig reads the KubeletConfig at the given path. A missing file yields an empty KubeletConfig.
+func LoadKubeletConfig(configPath string) (kc KubeletConfig, err error) {
+	if !FileExists(configPath) {
+		return
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		err = fmt.Errorf("cannot read kubelet config %q: %w", configPath, err)
+		return
+	}
+	err = json.Unmarshal(data, &kc)
+	if err != nil {
+		err = fmt.Errorf("cannot load kubelet config %q: %w", configPath, err)
+		return
+	}
+	klog.Infof("LoadKubeletConfig loaded %q with %d pool override(s)", configPath, len(kc.Pools))
+	return
+}
+
+// ForPool returns the KubeletReservation for the given worker pool, which is the Default overlaid with the pool
+// overrides.
+func (kc KubeletConfig) ForPool(poolName string) KubeletReservation {
+	r := KubeletReservation{
+		KubeReserved:   maps.Clone(kc.Default.KubeReserved),
+		SystemReserved: maps.Clone(kc.Default.SystemReserved),
+		EvictionHard:   maps.Clone(kc.Default.EvictionHard),
+	}
+	pool, ok := kc.Pools[poolName]
+	if !ok {
+		return r
+	}
+	if pool.KubeReserved != nil {
+		r.KubeReserved = maps.Clone(pool.KubeReserved)
+	}
+	if pool.SystemReserved != nil {
+		r.SystemReserved = maps.Clone(pool.SystemReserved)
+	}
+	if pool.EvictionHard != nil {
+		r.EvictionHard = maps.Clone(pool.EvictionHard)
+	}
+	return r
+}
+
+// ComputeKubeReserved returns the kube-reserved for the given capacity using the tiered formulas of gardener.
+// Explicitly configured KubeReserved resources take precedence.
+func (r KubeletReservation) ComputeKubeReserved(capacity corev1.ResourceList) corev1.ResourceList {
+	kubeReserved := corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(computeReservedCPUMillis(capacity.Cpu().MilliValue()), resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(computeReservedMemory(capacity.Memory().Value()), resource.BinarySI),
+	}
+	maps.Copy(kubeReserved, r.KubeReserved)
+	return kubeReserved
+}
+
+// ComputeAllocatable returns the allocatable resources for the given capacity, ie capacity minus kube-reserved,
+// system-reserved and the hard eviction thresholds, as computed by the kubelet.
+func (r KubeletReservation) ComputeAllocatable(capacity corev1.ResourceList) (allocatable corev1.ResourceList, err error) {
+	allocatable = maps.Clone(capacity)
+	kubeReserved := r.ComputeKubeReserved(capacity)
+	evictionHard := maps.Clone(DefaultEvictionHard)
+	maps.Copy(evictionHard, r.EvictionHard)
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		quantity, ok := allocatable[name]
+		if !ok {
+			continue
+		}
+		if reserved, ok := kubeReserved[name]; ok {
+			quantity.Sub(reserved)
+		}
+		if reserved, ok := r.SystemReserved[name]; ok {
+			quantity.Sub(reserved)
+		}
+		var threshold resource.Quantity
+		switch name {
+		case corev1.ResourceMemory:
+			threshold, err = parseThreshold(evictionHard[EvictionSignalMemoryAvailable], capacity[name])
+		case corev1.ResourceEphemeralStorage:
+			threshold, err = parseThreshold(evictionHard[EvictionSignalNodeFSAvailable], capacity[name])
+		}
+		if err != nil {
+			return
+		}
+		quantity.Sub(threshold)
+		if quantity.Sign() < 0 {
+			quantity.Set(0)
+		}
+		allocatable[name] = quantity
+	}
+	return
+}
+
+// parseThreshold parses an eviction threshold which is either a quantity or a percentage of the given capacity.
+func parseThreshold(threshold string, capacity resource.Quantity) (quantity resource.Quantity, err error) {
+	if threshold == "" {
+		return
+	}
+	if percent, ok := strings.CutSuffix(threshold, "%"); ok {
+		var p float64
+		p, err = strconv.ParseFloat(percent, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid eviction threshold %q: %w", threshold, err)
+			return
+		}
+		quantity = *resource.NewQuantity(int64(math.Round(float64(capacity.Value())*p/100)), capacity.Format)
+		return
+	}
+	quantity, err = resource.ParseQuantity(threshold)
+	if err != nil {
+		err = fmt.Errorf("invalid eviction threshold %q: %w", threshold, err)
+	}
+	return
+}
+
+// reservationTier reserves the given percent of the resource amount up to upTo that exceeds the previous tier.
+type reservationTier struct {
+	upTo    int64
+	percent float64
+}
+
+// computeReservedCPUMillis reserves 6% of the first core, 1% of the next core, 0.5% of the next 2 cores and 0.25% of
+// any cores above 4.
+func computeReservedCPUMillis(cpuMillis int64) int64 {
+	return computeTieredReservation(cpuMillis, []reservationTier{
+		{1000, 6},
+		{2000, 1},
+		{4000, 0.5},
+		{math.MaxInt64, 0.25},
+	})
+}
+
+// computeReservedMemory reserves 25% of the first 4Gi of memory, 20% of the next 4Gi, 10% of the next 8Gi, 6% of the
+// next 112Gi and 2% of any memory above 128Gi.
+func computeReservedMemory(memBytes int64) int64 {
+	const gi = 1024 * 1024 * 1024
+	return computeTieredReservation(memBytes, []reservationTier{
+		{4 * gi, 25},
+		{8 * gi, 20},
+		{16 * gi, 10},
+		{128 * gi, 6},
+		{math.MaxInt64, 2},
+	})
+}
+
+func computeTieredReservation(amount int64, tiers []reservationTier) int64 {
+	var reserved float64
+	var lower int64
+	for _, t := range tiers {
+		if amount <= lower {
+			break
+		}
+		reserved += float64(min(amount, t.upTo)-lower) * t.percent / 100
+		lower = t.upTo
+	}
+	return int64(math.Round(reserved))
+}
@@ -0,0 +1,76 @@
+package virtual
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestComputeAllocatable(t *testing.T) {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:              resource.MustParse("2"),
+		corev1.ResourceMemory:           resource.MustParse("8Gi"),
+		corev1.ResourceEphemeralStorage: resource.MustParse("100Gi"),
+		corev1.ResourcePods:             resource.MustParse("29"),
+	}
+	tests := []struct {
+		name        string
+		reservation KubeletReservation
+		expected    corev1.ResourceList
+	}{
+		{
+			name:        "gardener defaults",
+			reservation: KubeletReservation{},
+			expected: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse("1930m"),
+				corev1.ResourceMemory:           resource.MustParse("6552341709"), // 8Gi - (25% of 4Gi + 20% of 4Gi) - 100Mi
+				corev1.ResourceEphemeralStorage: resource.MustParse("95Gi"),
+				corev1.ResourcePods:             resource.MustParse("29"),
+			},
+		},
+		{
+			name: "overrides",
+			reservation: KubeletReservation{
+				KubeReserved:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				SystemReserved: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				EvictionHard:   map[string]string{EvictionSignalMemoryAvailable: "200Mi", EvictionSignalNodeFSAvailable: "10Gi"},
+			},
+			expected: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse("1830m"),
+				corev1.ResourceMemory:           resource.MustParse("6968Mi"),
+				corev1.ResourceEphemeralStorage: resource.MustParse("90Gi"),
+				corev1.ResourcePods:             resource.MustParse("29"),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			allocatable, err := tc.reservation.ComputeAllocatable(capacity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range tc.expected {
+				if got := allocatable[name]; got.Cmp(expected) != 0 {
+					t.Errorf("expected allocatable %s %s, got %s", name, expected.String(), got.String())
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletConfigForPool(t *testing.T) {
+	kc := KubeletConfig{
+		Default: KubeletReservation{KubeReserved: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("80m")}},
+		Pools: map[string]KubeletReservation{
+			"gpu": {EvictionHard: map[string]string{EvictionSignalMemoryAvailable: "1Gi"}},
+		},
+	}
+	r := kc.ForPool("gpu")
+	if got := r.KubeReserved[corev1.ResourceCPU]; got.Cmp(resource.MustParse("80m")) != 0 {
+		t.Errorf("expected default kube-reserved cpu 80m, got %s", got.String())
+	}
+	if r.EvictionHard[EvictionSignalMemoryAvailable] != "1Gi" {
+		t.Errorf("expected pool eviction threshold 1Gi, got %q", r.EvictionHard[EvictionSignalMemoryAvailable])
+	}
+}
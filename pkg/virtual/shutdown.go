@@ -0,0 +1,285 @@
+package virtual
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultShutdownGracePeriod is the default time in seconds the kubelet delays a node shutdown to terminate pods.
+	DefaultShutdownGracePeriod = 30
+	// DefaultShutdownGracePeriodCriticalPods is the default part of the DefaultShutdownGracePeriod in seconds reserved
+	// for terminating critical pods.
+	DefaultShutdownGracePeriodCriticalPods = 10
+
+	// OutOfServiceTaintValue is the value of the out-of-service taint added to nodes after a non-graceful shutdown.
+	OutOfServiceTaintValue = "nodeshutdown"
+
+	// systemCriticalPriority is the lowest priority of the system-cluster-critical and system-node-critical pods.
+	systemCriticalPriority = 2_000_000_000
+
+	nodeShutdownMessage = "Pod was terminated in response to imminent node shutdown."
+)
+
+// NodeShutdownConfig configures the simulated graceful and non-graceful node shutdowns. During a graceful shutdown,
+// the kubelet terminates regular pods within GracePeriod minus CriticalPodsGracePeriod and critical pods within the
+// remaining CriticalPodsGracePeriod, before the instance stops. After a non-graceful shutdown, the out-of-service
+// taint is added to the node once OutOfServiceTaintDelay has passed, unless it is 0 in which case the taint is left to
+// be added by hand.
+type NodeShutdownConfig struct {
+	// GracePeriod is the shutdownGracePeriod of the kubelet in seconds. Defaults to DefaultShutdownGracePeriod.
+	GracePeriod int64 `json:",omitempty"`
+	// CriticalPodsGracePeriod is the shutdownGracePeriodCriticalPods of the kubelet in seconds. Defaults to
+	// DefaultShutdownGracePeriodCriticalPods.
+	CriticalPodsGracePeriod int64 `json:",omitempty"`
+	// OutOfServiceTaintDelay is the time in seconds after which the out-of-service taint is added to a node after a
+	// non-graceful shutdown.
+	OutOfServiceTaintDelay int64 `json:",omitempty"`
+}
+
+// gracePeriods returns the time the kubelet has to terminate the regular and the critical pods.
+func (c NodeShutdownConfig) gracePeriods() (regular, critical time.Duration) {
+	total := cmp.Or(c.GracePeriod, DefaultShutdownGracePeriod)
+	criticalSecs := min(cmp.Or(c.CriticalPodsGracePeriod, DefaultShutdownGracePeriodCriticalPods), total)
+	return time.Duration(total-criticalSecs) * time.Second, time.Duration(criticalSecs) * time.Second
+}
+
+// isCriticalPod reports whether the kubelet treats the pod as critical during a node shutdown.
+func isCriticalPod(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return true
+	}
+	return pod.Spec.Priority != nil && *pod.Spec.Priority >= systemCriticalPriority
+}
+
+// podShutdownDelay returns the time after the begin of a graceful node shutdown at which the given pod terminates.
+// Critical pods are only terminated once the regular pods had their grace period.
+func podShutdownDelay(pod corev1.Pod, regular, critical time.Duration) time.Duration {
+	gracePeriod := time.Duration(ptr.Deref(pod.Spec.TerminationGracePeriodSeconds, corev1.DefaultTerminationGracePeriodSeconds)) * time.Second
+	if isCriticalPod(pod) {
+		return regular + min(gracePeriod, critical)
+	}
+	return min(gracePeriod, regular)
+}
+
+// shutdownNodeGracefully simulates a graceful shutdown of the node of the instance: the node turns NotReady, its pods
+// are terminated in the order of the kubelet and the instance is stopped once the shutdown grace period is over.
+func (d *DriverImpl) shutdownNodeGracefully(ctx context.Context, nodeName string) (err error) {
+	_, err = d.updateInstanceAnnotations(ctx, nodeName, map[string]string{AnnotationInstanceState: string(InstanceStateStopping)})
+	if err != nil {
+		return
+	}
+	err = setNodeShuttingDown(ctx, d.client, nodeName)
+	if err != nil {
+		return
+	}
+	pods, err := d.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list pods of node %q: %w", nodeName, err)
+	}
+	regular, critical := d.simConfig.NodeShutdown.gracePeriods()
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		namespace, name := pod.Namespace, pod.Name
+		time.AfterFunc(podShutdownDelay(pod, regular, critical), func() {
+			err := terminatePodOnShutdown(context.Background(), d.client, namespace, name)
+			if err != nil && !apierrors.IsNotFound(err) {
+				klog.Errorf("Failed to terminate pod %s/%s on shutdown of node %q: %v", namespace, name, nodeName, err)
+			}
+		})
+	}
+	klog.Infof("Shutting down node %q within %s", nodeName, regular+critical)
+	time.AfterFunc(regular+critical, func() {
+		d.completeShutdown(context.Background(), nodeName)
+	})
+	return
+}
+
+// completeShutdown stops the instance of the given node at the end of its graceful shutdown unless the instance was
+// deleted in the meantime.
+func (d *DriverImpl) completeShutdown(ctx context.Context, nodeName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, err := d.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("Failed to get node %q after shutdown: %v", nodeName, err)
+		return
+	}
+	if state := instanceStateOf(*node); state != InstanceStateStopping {
+		klog.Infof("Instance of node %q is %s - not stopping it after shutdown", nodeName, state)
+		return
+	}
+	err = d.stopInstance(ctx, nodeName)
+	if err != nil {
+		klog.Errorf("Failed to stop instance of node %q after shutdown: %v", nodeName, err)
+	}
+}
+
+// shutdownNodeNonGracefully simulates a shutdown of the node the kubelet does not notice, which leaves the pods of the
+// node terminating until the out-of-service taint is added to the node.
+func (d *DriverImpl) shutdownNodeNonGracefully(ctx context.Context, nodeName string) (err error) {
+	err = d.stopInstance(ctx, nodeName)
+	if err != nil {
+		return
+	}
+	delay := d.simConfig.NodeShutdown.OutOfServiceTaintDelay
+	if delay <= 0 {
+		return
+	}
+	klog.Infof("Adding out-of-service taint to node %q after %ds", nodeName, delay)
+	time.AfterFunc(time.Duration(delay)*time.Second, func() {
+		err := addNodeTaint(context.Background(), d.client, nodeName, corev1.Taint{Key: corev1.TaintNodeOutOfService, Value: OutOfServiceTaintValue, Effect: corev1.TaintEffectNoExecute})
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.Errorf("Failed to add out-of-service taint to node %q: %v", nodeName, err)
+		}
+	})
+	return
+}
+
+// stopInstance marks the instance of the given node stopped and makes its node unreachable.
+func (d *DriverImpl) stopInstance(ctx context.Context, nodeName string) (err error) {
+	_, err = d.updateInstanceAnnotations(ctx, nodeName, map[string]string{AnnotationInstanceState: string(InstanceStateStopped)})
+	if err != nil {
+		return
+	}
+	if _, unjoined := d.unjoinedInstances[nodeName]; unjoined {
+		return
+	}
+	return setNodeUnreachable(ctx, d.client, nodeName, true)
+}
+
+// setNodeShuttingDown sets the Ready condition of the node to False and adds the not-ready taint as happens once the
+// kubelet starts a graceful node shutdown.
+func setNodeShuttingDown(ctx context.Context, client kubernetes.Interface, nodeName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		node.Spec.Taints = addTaint(node.Spec.Taints, corev1.Taint{Key: corev1.TaintNodeNotReady, Effect: corev1.TaintEffectNoSchedule})
+		node, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		for i, c := range node.Status.Conditions {
+			if c.Type != corev1.NodeReady {
+				continue
+			}
+			node.Status.Conditions[i].Status = corev1.ConditionFalse
+			node.Status.Conditions[i].Reason = "KubeletNotReady"
+			node.Status.Conditions[i].Message = "node is shutting down"
+			node.Status.Conditions[i].LastTransitionTime = now
+		}
+		_, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// terminatePodOnShutdown sets the status of the given pod to that of a pod terminated by the kubelet during a graceful
+// node shutdown.
+func terminatePodOnShutdown(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod, err := client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		pod.Status.Phase = corev1.PodFailed
+		pod.Status.Reason = "Terminated"
+		pod.Status.Message = nodeShutdownMessage
+		pod.Status.Conditions = slices.DeleteFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+			return c.Type == corev1.DisruptionTarget
+		})
+		pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+			Type:               corev1.DisruptionTarget,
+			Status:             corev1.ConditionTrue,
+			Reason:             corev1.PodReasonTerminationByKubelet,
+			Message:            nodeShutdownMessage,
+			LastTransitionTime: now,
+		})
+		for i, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady || c.Type == corev1.ContainersReady {
+				pod.Status.Conditions[i].Status = corev1.ConditionFalse
+				pod.Status.Conditions[i].LastTransitionTime = now
+			}
+		}
+		for i := range pod.Status.ContainerStatuses {
+			cs := &pod.Status.ContainerStatuses[i]
+			cs.Ready = false
+			cs.State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode:   137,
+				Reason:     "Error",
+				FinishedAt: now,
+			}}
+		}
+		_, err = client.CoreV1().Pods(namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// forceDeleteOutOfServicePods force deletes the pods not tolerating the out-of-service taint from the not Ready nodes
+// carrying it, as the pod garbage collector does after a non-graceful node shutdown.
+func forceDeleteOutOfServicePods(ctx context.Context, client kubernetes.Interface, nodes []corev1.Node) {
+	for _, node := range nodes {
+		idx := slices.IndexFunc(node.Spec.Taints, func(t corev1.Taint) bool {
+			return t.Key == corev1.TaintNodeOutOfService && t.Effect == corev1.TaintEffectNoExecute
+		})
+		if idx < 0 || isNodeReady(node) {
+			continue
+		}
+		taint := node.Spec.Taints[idx]
+		pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+		})
+		if err != nil {
+			klog.Errorf("Cannot list pods of out-of-service node %q: %v", node.Name, err)
+			continue
+		}
+		for _, pod := range pods.Items {
+			if slices.ContainsFunc(pod.Spec.Tolerations, func(t corev1.Toleration) bool { return t.ToleratesTaint(&taint) }) {
+				continue
+			}
+			err = client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: ptr.To[int64](0)})
+			if err != nil && !apierrors.IsNotFound(err) {
+				klog.Errorf("Cannot force delete pod %s/%s of out-of-service node %q: %v", pod.Namespace, pod.Name, node.Name, err)
+				continue
+			}
+			klog.Infof("Force deleted pod %s/%s of out-of-service node %q", pod.Namespace, pod.Name, node.Name)
+		}
+	}
+}
+
+func isNodeReady(node corev1.Node) bool {
+	return slices.ContainsFunc(node.Status.Conditions, func(c corev1.NodeCondition) bool {
+		return c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue
+	})
+}
+
+func addNodeTaint(ctx context.Context, client kubernetes.Interface, nodeName string, taint corev1.Taint) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		node.Spec.Taints = addTaint(node.Spec.Taints, taint)
+		_, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
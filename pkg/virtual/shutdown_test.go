@@ -0,0 +1,148 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func TestPodShutdownDelay(t *testing.T) {
+	regular, critical := NodeShutdownConfig{GracePeriod: 30, CriticalPodsGracePeriod: 10}.gracePeriods()
+	if regular != 20*time.Second || critical != 10*time.Second {
+		t.Fatalf("gracePeriods() = %s, %s, want 20s, 10s", regular, critical)
+	}
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want time.Duration
+	}{
+		{"regular pod with default grace period", corev1.Pod{}, 20 * time.Second},
+		{"regular pod with short grace period", corev1.Pod{Spec: corev1.PodSpec{TerminationGracePeriodSeconds: ptr.To[int64](5)}}, 5 * time.Second},
+		{"critical pod", corev1.Pod{Spec: corev1.PodSpec{Priority: ptr.To[int32](systemCriticalPriority)}}, 30 * time.Second},
+		{"critical pod with short grace period", corev1.Pod{Spec: corev1.PodSpec{Priority: ptr.To[int32](systemCriticalPriority + 1000), TerminationGracePeriodSeconds: ptr.To[int64](2)}}, 22 * time.Second},
+		{"mirror pod", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "x"}}}, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podShutdownDelay(tt.pod, regular, critical); got != tt.want {
+				t.Errorf("podShutdownDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeShutdown(t *testing.T) {
+	ctx := context.Background()
+	newNode := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{LabelMachineName: name}},
+			Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionTrue)},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "graceful", TerminationGracePeriodSeconds: ptr.To[int64](0)},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "c", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+		},
+	}
+	client := fake.NewClientset(newNode("graceful"), newNode("non-graceful"), pod)
+	d := &DriverImpl{
+		client:            client,
+		managedNodes:      make(map[string]corev1.Node),
+		unjoinedInstances: make(map[string]corev1.Node),
+		// the instance is stopped long after the regular pod terminated
+		simConfig: SimulationConfig{NodeShutdown: NodeShutdownConfig{GracePeriod: 3600, CriticalPodsGracePeriod: 1800}},
+	}
+	if err := d.reloadNodes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.TriggerInstanceEvent(ctx, "graceful", InstanceEventShutdown); err != nil {
+		t.Fatalf("TriggerInstanceEvent() err = %v", err)
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, "graceful", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStateOf(*node); got != InstanceStateStopping {
+		t.Errorf("instance state of node shutting down = %q, want %q", got, InstanceStateStopping)
+	}
+	if c := node.Status.Conditions[0]; c.Status != corev1.ConditionFalse || c.Message != "node is shutting down" {
+		t.Errorf("Ready condition of node shutting down = %v", c)
+	}
+	var terminated *corev1.Pod
+	for range 50 {
+		if terminated, err = client.CoreV1().Pods("default").Get(ctx, "p1", metav1.GetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if terminated.Status.Phase == corev1.PodFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if terminated.Status.Phase != corev1.PodFailed || terminated.Status.Message != nodeShutdownMessage {
+		t.Errorf("pod status after shutdown = %s %q, want %s %q", terminated.Status.Phase, terminated.Status.Message, corev1.PodFailed, nodeShutdownMessage)
+	}
+	if terminated.Status.ContainerStatuses[0].State.Terminated == nil {
+		t.Errorf("container state after shutdown = %v, want terminated", terminated.Status.ContainerStatuses[0].State)
+	}
+
+	stopping := newNode("stopping")
+	stopping.Annotations = map[string]string{AnnotationInstanceState: string(InstanceStateStopping)}
+	if _, err = client.CoreV1().Nodes().Create(ctx, stopping, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	d.completeShutdown(ctx, "stopping")
+	if node, err = client.CoreV1().Nodes().Get(ctx, "stopping", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStateOf(*node); got != InstanceStateStopped {
+		t.Errorf("instance state after shutdown = %q, want %q", got, InstanceStateStopped)
+	}
+	// the machine is deleted during the grace period
+	if _, err = setInstanceState(ctx, client, "graceful", InstanceStateShuttingDown, false); err != nil {
+		t.Fatal(err)
+	}
+	d.completeShutdown(ctx, "graceful")
+	if node, err = client.CoreV1().Nodes().Get(ctx, "graceful", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStateOf(*node); got != InstanceStateShuttingDown {
+		t.Errorf("instance state after shutdown of deleted instance = %q, want %q", got, InstanceStateShuttingDown)
+	}
+
+	if err = d.TriggerInstanceEvent(ctx, "non-graceful", InstanceEventNonGracefulShutdown); err != nil {
+		t.Fatalf("TriggerInstanceEvent() err = %v", err)
+	}
+	node, err = client.CoreV1().Nodes().Get(ctx, "non-graceful", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStateOf(*node); got != InstanceStateStopped {
+		t.Errorf("instance state after non-graceful shutdown = %q, want %q", got, InstanceStateStopped)
+	}
+	stuck := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p2", Namespace: "default"}, Spec: corev1.PodSpec{NodeName: "non-graceful"}}
+	if _, err = client.CoreV1().Pods("default").Create(ctx, stuck, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = addNodeTaint(ctx, client, "non-graceful", corev1.Taint{Key: corev1.TaintNodeOutOfService, Value: OutOfServiceTaintValue, Effect: corev1.TaintEffectNoExecute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err = client.CoreV1().Nodes().Get(ctx, "non-graceful", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forceDeleteOutOfServicePods(ctx, client, []corev1.Node{*node})
+	if _, err = client.CoreV1().Pods("default").Get(ctx, "p2", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected pod of out-of-service node to be deleted, got err = %v", err)
+	}
+}
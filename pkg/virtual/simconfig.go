@@ -0,0 +1,521 @@
+package virtual
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// SimulationConfigPath is the legacy SimulationConfig file, which seeds the SimulationConfig ConfigMap if present
+// when the ConfigMap does not exist yet.
+var SimulationConfigPath = "gen/simulation-config.json"
+
+// SimulationConfigMapName is the name of the ConfigMap in the shoot namespace holding the SimulationConfig under the
+// SimulationConfigYAMLKey or the SimulationConfigKey.
+var SimulationConfigMapName = "virtual-simulation-config"
+
+const (
+	// SimulationConfigYAMLKey is the key of the YAML or JSON SimulationConfig in the SimulationConfig ConfigMap.
+	SimulationConfigYAMLKey = "simulation-config.yaml"
+	// SimulationConfigKey is the key of the SimulationConfig in SimulationConfig ConfigMaps created before the
+	// SimulationConfigYAMLKey, which is still read if the SimulationConfigYAMLKey is absent.
+	SimulationConfigKey = "simulation-config.json"
+
+	// SimulationConfigAPIVersion is the current version of the SimulationConfig schema. SimulationConfigs of older
+	// versions are migrated to it on load.
+	SimulationConfigAPIVersion = "virtual.gardener.cloud/v1alpha1"
+	// SimulationConfigKind is the kind of the SimulationConfig.
+	SimulationConfigKind = "SimulationConfig"
+)
+
+// simulationConfigMigrations migrates a SimulationConfig of the keyed apiVersion to the next version, which is set by
+// the migration. The empty apiVersion keys the unversioned SimulationConfig predating SimulationConfigAPIVersion.
+var simulationConfigMigrations = map[string]func(s *SimulationConfig){
+	"": migrateUnversionedSimulationConfig,
+}
+
+// DecodeSimulationConfig decodes the given YAML or JSON SimulationConfig and migrates it to the
+// SimulationConfigAPIVersion.
+func DecodeSimulationConfig(data []byte) (s SimulationConfig, err error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidSimulationConfig, err)
+		return
+	}
+	err = json.Unmarshal(jsonData, &s)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidSimulationConfig, err)
+		return
+	}
+	if s.Kind != "" && s.Kind != SimulationConfigKind {
+		err = fmt.Errorf("%w: unsupported kind %q, want %q", ErrInvalidSimulationConfig, s.Kind, SimulationConfigKind)
+		return
+	}
+	for s.APIVersion != SimulationConfigAPIVersion {
+		migrate, ok := simulationConfigMigrations[s.APIVersion]
+		if !ok {
+			err = fmt.Errorf("%w: unsupported apiVersion %q, want %q", ErrInvalidSimulationConfig, s.APIVersion, SimulationConfigAPIVersion)
+			return
+		}
+		from := s.APIVersion
+		migrate(&s)
+		klog.Infof("Migrated SimulationConfig from apiVersion %q to %q", from, s.APIVersion)
+	}
+	s.Kind = SimulationConfigKind
+	return
+}
+
+// migrateUnversionedSimulationConfig migrates an unversioned SimulationConfig, whose delays lasted between their
+// minimum and their minimum plus their maximum, to delays lasting between their minimum and maximum.
+func migrateUnversionedSimulationConfig(s *SimulationConfig) {
+	delays := &s.InstanceDelays
+	for _, d := range [][2]*int64{
+		{&delays.CreateMin, &delays.CreateMax},
+		{&delays.InitializeMin, &delays.InitializeMax},
+		{&delays.JoinMin, &delays.JoinMax},
+		{&delays.DeleteMin, &delays.DeleteMax},
+		{&delays.RebootMin, &delays.RebootMax},
+	} {
+		if *d[1] > 0 {
+			*d[1] += *d[0]
+		}
+	}
+	for i := range s.StartupTaints {
+		if t := &s.StartupTaints[i]; t.RemovalDelayMax > 0 {
+			t.RemovalDelayMax += t.RemovalDelayMin
+		}
+	}
+	s.APIVersion = SimulationConfigAPIVersion
+}
+
+// createSimulationConfig loads the SimulationConfig from the SimulationConfigMapName ConfigMap in the shoot namespace.
+// If the ConfigMap does not exist, it is created from the legacy SimulationConfigPath file if present or else from a
+// default SimulationConfig derived from the MachineClasses, along with the quotas synced from the MachineClasses.
+func (d *DriverImpl) createSimulationConfig(ctx context.Context) error {
+	cm, err := d.client.CoreV1().ConfigMaps(d.shootNamespace).Get(ctx, SimulationConfigMapName, metav1.GetOptions{})
+	if err == nil {
+		klog.Infof("SimulationConfig ConfigMap %s/%s already exists - loading", d.shootNamespace, SimulationConfigMapName)
+		err = d.applySimulationConfigMap(cm)
+		if !errors.Is(err, ErrInvalidSimulationConfig) {
+			return err
+		}
+		klog.Errorf("createSimulationConfig falls back to the default SimulationConfig until the ConfigMap is fixed: %v", err)
+		return d.applyDefaultSimulationConfig(ctx, cm)
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("cannot get SimulationConfig ConfigMap %s/%s: %w", d.shootNamespace, SimulationConfigMapName, err)
+	}
+	machineClasses, err := d.listMachineClasses(ctx)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if FileExists(SimulationConfigPath) {
+		klog.Infof("Seeding SimulationConfig ConfigMap from %q", SimulationConfigPath)
+		data, err = os.ReadFile(SimulationConfigPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err = yaml.Marshal(defaultSimulationConfig(machineClasses))
+		if err != nil {
+			return err
+		}
+	}
+	cm = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: SimulationConfigMapName, Namespace: d.shootNamespace},
+		Data:       map[string]string{SimulationConfigYAMLKey: string(data)},
+	}
+	// an invalid seed is rejected when applying the ConfigMap below, which syncs quotas as per the default QuotaSync.
+	seed, _ := DecodeSimulationConfig(data)
+	if !seed.QuotaSync.Disabled {
+		quotas, err := yaml.Marshal(machineClassQuotas(machineClasses, seed.QuotaSync.GetDefaultAmount()))
+		if err != nil {
+			return err
+		}
+		cm.Data[SimulationConfigQuotasKey] = string(quotas)
+	}
+	cm, err = d.client.CoreV1().ConfigMaps(d.shootNamespace).Create(ctx, cm, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot create SimulationConfig ConfigMap %s/%s: %w", d.shootNamespace, SimulationConfigMapName, err)
+	}
+	klog.Infof("createSimulationConfig created SimulationConfig ConfigMap %s/%s", d.shootNamespace, SimulationConfigMapName)
+	return d.applySimulationConfigMap(cm)
+}
+
+// listMachineClasses returns the MachineClasses of the shoot namespace sorted by name.
+func (d *DriverImpl) listMachineClasses(ctx context.Context) (machineClasses []*v1alpha1.MachineClass, err error) {
+	machineClassList, err := d.machineClient.MachineV1alpha1().MachineClasses(d.shootNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		err = fmt.Errorf("cannot list MachineClasses: %w", err)
+		return
+	}
+	for i := range machineClassList.Items {
+		machineClasses = append(machineClasses, &machineClassList.Items[i])
+	}
+	slices.SortFunc(machineClasses, func(a, b *v1alpha1.MachineClass) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return
+}
+
+// defaultSimulationConfig returns the default SimulationConfig with a subnet for each zone of the given
+// MachineClasses. Their quotas are synced separately.
+func defaultSimulationConfig(machineClasses []*v1alpha1.MachineClass) (simConfig SimulationConfig) {
+	var zones []string
+	for _, mc := range machineClasses {
+		if mc.NodeTemplate == nil {
+			continue
+		}
+		if zone := mc.NodeTemplate.Zone; zone != "" && !slices.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	simConfig.APIVersion = SimulationConfigAPIVersion
+	simConfig.Kind = SimulationConfigKind
+	simConfig.InstanceDelays = DefaultInstanceDelays
+	simConfig.StartupTaints = DefaultStartupTaints()
+	simConfig.Network = DefaultNetworkConfig(zones)
+	return
+}
+
+// applyDefaultSimulationConfig makes the default SimulationConfig the current one without storing it. Its quotas are
+// the synced quotas of the given SimulationConfig ConfigMap if present, or else the quotas of the MachineClasses.
+func (d *DriverImpl) applyDefaultSimulationConfig(ctx context.Context, cm *corev1.ConfigMap) error {
+	machineClasses, err := d.listMachineClasses(ctx)
+	if err != nil {
+		return err
+	}
+	sm := defaultSimulationConfig(machineClasses)
+	sm.Quotas = machineClassQuotas(machineClasses, sm.QuotaSync.GetDefaultAmount())
+	if data, ok := cm.Data[SimulationConfigQuotasKey]; ok {
+		var synced []Quota
+		if err = yaml.Unmarshal([]byte(data), &synced); err == nil {
+			sm.Quotas = synced
+		}
+	}
+	sm.Default()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.simConfig = sm
+	d.lastSimConfigChange = time.Now().UTC()
+	return nil
+}
+
+// watchSimulationConfig applies the changes of the SimulationConfig ConfigMap as they happen until the context is done.
+func (d *DriverImpl) watchSimulationConfig(ctx context.Context) {
+	factory := informers.NewSharedInformerFactoryWithOptions(d.client, 0,
+		informers.WithNamespace(d.shootNamespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", SimulationConfigMapName).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	onChange := func(obj any) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok || cm.Name != SimulationConfigMapName {
+			return
+		}
+		err := d.applySimulationConfigMap(cm)
+		if err != nil {
+			klog.Errorf("watchSimulationConfig cannot apply SimulationConfig ConfigMap %s/%s - keeping the current SimulationConfig: %v", cm.Namespace, cm.Name, err)
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(_, obj any) { onChange(obj) },
+		DeleteFunc: func(any) {
+			klog.Warningf("SimulationConfig ConfigMap %s/%s was deleted - keeping the current SimulationConfig", d.shootNamespace, SimulationConfigMapName)
+		},
+	})
+	if err != nil {
+		klog.Errorf("watchSimulationConfig cannot watch SimulationConfig ConfigMap: %v", err)
+		return
+	}
+	informer.Run(ctx.Done())
+}
+
+// applySimulationConfigMap makes the defaulted SimulationConfig of the given ConfigMap the current one unless it was
+// applied already. An invalid SimulationConfig is rejected, which keeps the current one.
+func (d *DriverImpl) applySimulationConfigMap(cm *corev1.ConfigMap) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cm.ResourceVersion != "" && cm.ResourceVersion == d.simConfigVersion {
+		return nil
+	}
+	sm, err := simulationConfigOf(cm)
+	if err != nil {
+		return err
+	}
+	d.simConfig = sm
+	d.simConfigVersion = cm.ResourceVersion
+	d.lastSimConfigChange = time.Now().UTC()
+	klog.Infof("applySimulationConfigMap loaded version %q of %s/%s at %q, simConfig=%v", cm.ResourceVersion, cm.Namespace, cm.Name, d.lastSimConfigChange, d.simConfig)
+	return nil
+}
+
+// simulationConfigOf returns the defaulted and validated SimulationConfig of the given ConfigMap including its synced
+// quotas.
+func simulationConfigOf(cm *corev1.ConfigMap) (sm SimulationConfig, err error) {
+	data, ok := cm.Data[SimulationConfigYAMLKey]
+	if !ok {
+		data, ok = cm.Data[SimulationConfigKey]
+	}
+	if !ok {
+		err = fmt.Errorf("%w: ConfigMap %s/%s has neither a %q nor a %q key", ErrInvalidSimulationConfig, cm.Namespace, cm.Name, SimulationConfigYAMLKey, SimulationConfigKey)
+		return
+	}
+	sm, err = DecodeSimulationConfig([]byte(data))
+	if err != nil {
+		err = fmt.Errorf("cannot decode SimulationConfig of ConfigMap %s/%s: %w", cm.Namespace, cm.Name, err)
+		return
+	}
+	if data, ok := cm.Data[SimulationConfigQuotasKey]; ok && !sm.QuotaSync.Disabled {
+		var synced []Quota
+		if err = yaml.Unmarshal([]byte(data), &synced); err != nil {
+			err = fmt.Errorf("%w: cannot decode %q of ConfigMap %s/%s: %w", ErrInvalidSimulationConfig, SimulationConfigQuotasKey, cm.Namespace, cm.Name, err)
+			return
+		}
+		sm.Quotas = mergeQuotas(sm.Quotas, synced)
+	}
+	sm.Default()
+	if errs := sm.Validate(); len(errs) > 0 {
+		err = fmt.Errorf("%w of ConfigMap %s/%s: %w", ErrInvalidSimulationConfig, cm.Namespace, cm.Name, errs.ToAggregate())
+	}
+	return
+}
+
+// ErrInvalidSimulationConfig is returned when a SimulationConfig fails validation.
+var ErrInvalidSimulationConfig = errors.New("invalid SimulationConfig")
+
+// DefaultInstanceDelays are the InstanceDelays used for delays whose minimum and maximum are both unset.
+var DefaultInstanceDelays = InstanceDelays{
+	CreateMin:     1,
+	CreateMax:     2,
+	InitializeMin: 1,
+	InitializeMax: 2,
+	JoinMin:       2,
+	JoinMax:       4,
+	DeleteMin:     1,
+	DeleteMax:     2,
+}
+
+// Default sets the unset delays of the SimulationConfig. A delay without minimum and maximum gets the one of the
+// DefaultInstanceDelays and a delay with only a minimum is fixed to it.
+func (s *SimulationConfig) Default() {
+	delays := &s.InstanceDelays
+	defaultDelay(&delays.CreateMin, &delays.CreateMax, DefaultInstanceDelays.CreateMin, DefaultInstanceDelays.CreateMax)
+	defaultDelay(&delays.InitializeMin, &delays.InitializeMax, DefaultInstanceDelays.InitializeMin, DefaultInstanceDelays.InitializeMax)
+	defaultDelay(&delays.JoinMin, &delays.JoinMax, DefaultInstanceDelays.JoinMin, DefaultInstanceDelays.JoinMax)
+	defaultDelay(&delays.DeleteMin, &delays.DeleteMax, DefaultInstanceDelays.DeleteMin, DefaultInstanceDelays.DeleteMax)
+	defaultDelay(&delays.RebootMin, &delays.RebootMax, int64(DefaultRebootDuration.Seconds()), int64(DefaultRebootDuration.Seconds()))
+	for i := range s.StartupTaints {
+		defaultDelay(&s.StartupTaints[i].RemovalDelayMin, &s.StartupTaints[i].RemovalDelayMax, 0, 0)
+	}
+}
+
+func defaultDelay(minSecs, maxSecs *int64, defaultMin, defaultMax int64) {
+	if *maxSecs != 0 {
+		return
+	}
+	if *minSecs == 0 {
+		*minSecs, *maxSecs = defaultMin, defaultMax
+		return
+	}
+	*maxSecs = *minSecs
+}
+
+// Validate validates the SimulationConfig.
+func (s SimulationConfig) Validate() field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	allErrs = append(allErrs, validateQuotas(s.Quotas, field.NewPath("Quotas"))...)
+	allErrs = append(allErrs, validateInstanceDelays(s.InstanceDelays, field.NewPath("InstanceDelays"))...)
+	allErrs = append(allErrs, validateStartupTaints(s.StartupTaints, field.NewPath("StartupTaints"))...)
+	allErrs = append(allErrs, validateRevokedCredentials(s.RevokedCredentials, field.NewPath("RevokedCredentials"))...)
+	allErrs = append(allErrs, validateNetworkConfig(s.Network, field.NewPath("Network"))...)
+	allErrs = append(allErrs, validateProbability(s.DuplicateInstanceProbability, field.NewPath("DuplicateInstanceProbability"))...)
+	allErrs = append(allErrs, validateProbability(s.StuckTerminationProbability, field.NewPath("StuckTerminationProbability"))...)
+	if s.CloudControllerManager.SyncPeriod < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("CloudControllerManager", "SyncPeriod"), s.CloudControllerManager.SyncPeriod, "must not be negative"))
+	}
+	allErrs = append(allErrs, validateJoinFailures(s.JoinFailures, field.NewPath("JoinFailures"))...)
+	if s.NodeNaming != "" && s.NodeNaming != NodeNamingMachineName && s.NodeNaming != NodeNamingPrivateDNSName {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("NodeNaming"), s.NodeNaming, []string{NodeNamingMachineName, NodeNamingPrivateDNSName}))
+	}
+	allErrs = append(allErrs, validateInstanceEvents(s.InstanceEvents, field.NewPath("InstanceEvents"))...)
+	allErrs = append(allErrs, validateNodeShutdown(s.NodeShutdown, field.NewPath("NodeShutdown"))...)
+	allErrs = append(allErrs, validateSpotConfig(s.Spot, field.NewPath("Spot"))...)
+	allErrs = append(allErrs, validateOverrides(s.Overrides, field.NewPath("Overrides"))...)
+	allErrs = append(allErrs, validateQuotaSync(s.QuotaSync, field.NewPath("QuotaSync"))...)
+
+	return allErrs
+}
+
+func validateQuotas(quotas []Quota, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := make(map[QuotaLookup]bool)
+	for i, q := range quotas {
+		idxPath := fldPath.Index(i)
+		if q.MachineType == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("MachineType"), "MachineType is required"))
+		}
+		if q.Region == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("Region"), "Region is required"))
+		}
+		if q.Amount < 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("Amount"), q.Amount, "must not be negative"))
+		}
+		key := QuotaLookup{MachineType: q.MachineType, RegionName: q.Region}
+		if seen[key] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, q.String()))
+		}
+		seen[key] = true
+	}
+	return allErrs
+}
+
+func validateInstanceDelays(delays InstanceDelays, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validateDelay(delays.CreateMin, delays.CreateMax, fldPath.Child("CreateMin"), fldPath.Child("CreateMax"))...)
+	allErrs = append(allErrs, validateDelay(delays.InitializeMin, delays.InitializeMax, fldPath.Child("InitializeMin"), fldPath.Child("InitializeMax"))...)
+	allErrs = append(allErrs, validateDelay(delays.JoinMin, delays.JoinMax, fldPath.Child("JoinMin"), fldPath.Child("JoinMax"))...)
+	allErrs = append(allErrs, validateDelay(delays.DeleteMin, delays.DeleteMax, fldPath.Child("DeleteMin"), fldPath.Child("DeleteMax"))...)
+	allErrs = append(allErrs, validateDelay(delays.RebootMin, delays.RebootMax, fldPath.Child("RebootMin"), fldPath.Child("RebootMax"))...)
+	return allErrs
+}
+
+func validateDelay(minSecs, maxSecs int64, minPath, maxPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if minSecs < 0 {
+		allErrs = append(allErrs, field.Invalid(minPath, minSecs, "must not be negative"))
+	}
+	if maxSecs < 0 {
+		allErrs = append(allErrs, field.Invalid(maxPath, maxSecs, "must not be negative"))
+	}
+	if minSecs > maxSecs {
+		allErrs = append(allErrs, field.Invalid(maxPath, maxSecs, fmt.Sprintf("must not be less than %s (%d)", minPath.String(), minSecs)))
+	}
+	return allErrs
+}
+
+func validateStartupTaints(taints []StartupTaint, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validEffects := []string{string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute)}
+	for i, t := range taints {
+		idxPath := fldPath.Index(i)
+		if t.Key == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("Key"), "Key is required"))
+		}
+		if !slices.Contains(validEffects, string(t.Effect)) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("Effect"), t.Effect, validEffects))
+		}
+		allErrs = append(allErrs, validateDelay(t.RemovalDelayMin, t.RemovalDelayMax, idxPath.Child("RemovalDelayMin"), idxPath.Child("RemovalDelayMax"))...)
+	}
+	return allErrs
+}
+
+func validateRevokedCredentials(credentials []RevokedCredential, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validReasons := []string{RevocationReasonAuthFailure, RevocationReasonUnauthorizedOperation}
+	for i, c := range credentials {
+		idxPath := fldPath.Index(i)
+		if c.AccessKeyID == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("AccessKeyID"), "AccessKeyID is required"))
+		}
+		if c.Reason != "" && !slices.Contains(validReasons, c.Reason) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("Reason"), c.Reason, validReasons))
+		}
+	}
+	return allErrs
+}
+
+func validateNetworkConfig(network NetworkConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, s := range network.Subnets {
+		if _, err := netip.ParsePrefix(s.CIDR); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("Subnets").Index(i).Child("CIDR"), s.CIDR, err.Error()))
+		}
+	}
+	if network.PodsCIDR != "" {
+		if _, err := netip.ParsePrefix(network.PodsCIDR); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("PodsCIDR"), network.PodsCIDR, err.Error()))
+		}
+	}
+	if network.NodeCIDRMaskSize < 0 || network.NodeCIDRMaskSize > 32 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("NodeCIDRMaskSize"), network.NodeCIDRMaskSize, "must be between 0 and 32"))
+	}
+	return allErrs
+}
+
+func validateProbability(p float64, fldPath *field.Path) field.ErrorList {
+	if p < 0 || p > 1 {
+		return field.ErrorList{field.Invalid(fldPath, p, "must be between 0 and 1")}
+	}
+	return nil
+}
+
+func validateJoinFailures(joinFailures []JoinFailure, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validModes := []string{JoinFailureNoNode, JoinFailureNotReady}
+	for i, jf := range joinFailures {
+		idxPath := fldPath.Index(i)
+		allErrs = append(allErrs, validateProbability(jf.Probability, idxPath.Child("Probability"))...)
+		if jf.Mode != "" && !slices.Contains(validModes, jf.Mode) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("Mode"), jf.Mode, validModes))
+		}
+	}
+	return allErrs
+}
+
+func validateInstanceEvents(events []ScheduledInstanceEvent, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validTypes := []string{InstanceEventReboot, InstanceEventStop, InstanceEventRetirement, InstanceEventShutdown, InstanceEventNonGracefulShutdown}
+	for i, e := range events {
+		idxPath := fldPath.Index(i)
+		if !slices.Contains(validTypes, e.Type) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("Type"), e.Type, validTypes))
+		}
+		if e.MachineName == "" && e.MachineClass == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("MachineName"), "MachineName or MachineClass is required"))
+		}
+		if e.At.IsZero() {
+			allErrs = append(allErrs, field.Required(idxPath.Child("At"), "At is required"))
+		}
+	}
+	return allErrs
+}
+
+func validateNodeShutdown(shutdown NodeShutdownConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if shutdown.GracePeriod < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("GracePeriod"), shutdown.GracePeriod, "must not be negative"))
+	}
+	if shutdown.CriticalPodsGracePeriod < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("CriticalPodsGracePeriod"), shutdown.CriticalPodsGracePeriod, "must not be negative"))
+	}
+	if shutdown.GracePeriod > 0 && shutdown.CriticalPodsGracePeriod > shutdown.GracePeriod {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("CriticalPodsGracePeriod"), shutdown.CriticalPodsGracePeriod, "must not exceed GracePeriod"))
+	}
+	if shutdown.OutOfServiceTaintDelay < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("OutOfServiceTaintDelay"), shutdown.OutOfServiceTaintDelay, "must not be negative"))
+	}
+	return allErrs
+}
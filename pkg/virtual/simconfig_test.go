@@ -0,0 +1,188 @@
+package virtual
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchSimulationConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: SimulationConfigMapName, Namespace: "shoot--p--s", ResourceVersion: "1"},
+		Data:       map[string]string{SimulationConfigKey: `{"Quotas":[{"MachineType":"m5.large","Region":"eu-west-1","Amount":1}]}`},
+	}
+	client := fake.NewClientset(cm)
+	d := &DriverImpl{client: client, shootNamespace: "shoot--p--s"}
+
+	if err := d.createSimulationConfig(ctx); err != nil {
+		t.Fatalf("createSimulationConfig() err = %v", err)
+	}
+	if got := d.simConfig.Quotas[0].Amount; got != 1 {
+		t.Fatalf("quota amount = %d, want 1", got)
+	}
+	go d.watchSimulationConfig(ctx)
+
+	cm = cm.DeepCopy()
+	cm.ResourceVersion = "2"
+	cm.Data[SimulationConfigKey] = `{"Quotas":[{"MachineType":"m5.large","Region":"eu-west-1","Amount":5}]}`
+	if _, err := client.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d.mu.Lock()
+		amount := d.simConfig.Quotas[0].Amount
+		d.mu.Unlock()
+		if amount == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("quota amount = %d after ConfigMap update, want 5", amount)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cm = cm.DeepCopy()
+	cm.ResourceVersion = "3"
+	cm.Data[SimulationConfigKey] = `{"Quotas":`
+	if err := d.applySimulationConfigMap(cm); err == nil {
+		t.Error("expected invalid SimulationConfig to be rejected")
+	}
+	if got := d.simConfig.Quotas[0].Amount; got != 5 {
+		t.Errorf("quota amount after invalid update = %d, want 5", got)
+	}
+}
+
+func TestSimulationConfigValidate(t *testing.T) {
+	valid := SimulationConfig{
+		Quotas:         []Quota{{MachineType: "m5.large", Region: "eu-west-1", Amount: 1}},
+		InstanceDelays: InstanceDelays{CreateMin: 1, CreateMax: 2},
+		StartupTaints:  DefaultStartupTaints(),
+		Network:        DefaultNetworkConfig([]string{"eu-west-1a"}),
+	}
+	tests := []struct {
+		name     string
+		mutate   func(s *SimulationConfig)
+		wantErrs []string
+	}{
+		{"valid", func(*SimulationConfig) {}, nil},
+		{"min exceeds max", func(s *SimulationConfig) { s.InstanceDelays.JoinMin, s.InstanceDelays.JoinMax = 5, 2 }, []string{"InstanceDelays.JoinMax"}},
+		{"negative amount", func(s *SimulationConfig) { s.Quotas[0].Amount = -1 }, []string{"Quotas[0].Amount"}},
+		{"duplicate quota", func(s *SimulationConfig) { s.Quotas = append(s.Quotas, s.Quotas[0]) }, []string{"Quotas[1]"}},
+		{"invalid probability", func(s *SimulationConfig) { s.StuckTerminationProbability = 1.5 }, []string{"StuckTerminationProbability"}},
+		{"unknown node naming", func(s *SimulationConfig) { s.NodeNaming = "Random" }, []string{"NodeNaming"}},
+		{"invalid subnet", func(s *SimulationConfig) { s.Network.Subnets[0].CIDR = "10.250.0.0" }, []string{"Network.Subnets[0].CIDR"}},
+		{"untargeted instance event", func(s *SimulationConfig) {
+			s.InstanceEvents = []ScheduledInstanceEvent{{Type: "explode", At: time.Now()}}
+		}, []string{"InstanceEvents[0].Type", "InstanceEvents[0].MachineName"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			s.Quotas = slices.Clone(valid.Quotas)
+			s.Network.Subnets = slices.Clone(valid.Network.Subnets)
+			tt.mutate(&s)
+			var gotErrs []string
+			for _, err := range s.Validate() {
+				gotErrs = append(gotErrs, err.Field)
+			}
+			if !slices.Equal(gotErrs, tt.wantErrs) {
+				t.Errorf("Validate() errors on %v, want %v", gotErrs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestSimulationConfigDefault(t *testing.T) {
+	s := SimulationConfig{InstanceDelays: InstanceDelays{CreateMin: 3, JoinMin: 1, JoinMax: 8}}
+	s.Default()
+	want := DefaultInstanceDelays
+	want.CreateMin, want.CreateMax = 3, 3
+	want.JoinMin, want.JoinMax = 1, 8
+	want.RebootMin, want.RebootMax = 30, 30
+	if s.InstanceDelays != want {
+		t.Errorf("Default() InstanceDelays = %+v, want %+v", s.InstanceDelays, want)
+	}
+}
+
+func TestApplySimulationConfigMapRejectsInvalid(t *testing.T) {
+	d := &DriverImpl{simConfig: SimulationConfig{Quotas: []Quota{{MachineType: "m5.large", Region: "eu-west-1", Amount: 2}}}}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: SimulationConfigMapName, ResourceVersion: "7"},
+		Data:       map[string]string{SimulationConfigKey: `{"apiVersion":"virtual.gardener.cloud/v1alpha1","InstanceDelays":{"CreateMin":5,"CreateMax":1}}`},
+	}
+	err := d.applySimulationConfigMap(cm)
+	if !errors.Is(err, ErrInvalidSimulationConfig) {
+		t.Fatalf("applySimulationConfigMap() err = %v, want %v", err, ErrInvalidSimulationConfig)
+	}
+	if len(d.simConfig.Quotas) != 1 || d.simConfigVersion != "" {
+		t.Errorf("expected previous SimulationConfig to be kept, got %+v", d.simConfig)
+	}
+}
+
+func TestRandomDuration(t *testing.T) {
+	if got := randomDuration(0, 0); got != 0 {
+		t.Errorf("randomDuration(0, 0) = %s, want 0s", got)
+	}
+	if got := randomDuration(3, 1); got != 3*time.Second {
+		t.Errorf("randomDuration(3, 1) = %s, want 3s", got)
+	}
+	for range 100 {
+		if got := randomDuration(1, 2); got < time.Second || got > 2*time.Second {
+			t.Fatalf("randomDuration(1, 2) = %s, want between 1s and 2s", got)
+		}
+	}
+}
+
+func TestDecodeSimulationConfig(t *testing.T) {
+	yamlConfig := `
+apiVersion: virtual.gardener.cloud/v1alpha1
+kind: SimulationConfig
+InstanceDelays:
+  CreateMin: 1
+  CreateMax: 3
+Quotas:
+- &m5 # shared by all regions
+  MachineType: m5.large
+  Region: eu-west-1
+  Amount: 4
+- <<: *m5
+  Region: eu-central-1
+`
+	s, err := DecodeSimulationConfig([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("DecodeSimulationConfig() err = %v", err)
+	}
+	if s.InstanceDelays.CreateMax != 3 || len(s.Quotas) != 2 || s.Quotas[1] != (Quota{MachineType: "m5.large", Region: "eu-central-1", Amount: 4}) {
+		t.Errorf("DecodeSimulationConfig() = %+v", s)
+	}
+
+	s, err = DecodeSimulationConfig([]byte(`{"InstanceDelays":{"CreateMin":1,"CreateMax":2},"StartupTaints":[{"Key":"k","Effect":"NoSchedule","RemovalDelayMin":2,"RemovalDelayMax":1}]}`))
+	if err != nil {
+		t.Fatalf("DecodeSimulationConfig() of unversioned SimulationConfig err = %v", err)
+	}
+	if s.APIVersion != SimulationConfigAPIVersion || s.Kind != SimulationConfigKind {
+		t.Errorf("migrated SimulationConfig has apiVersion %q and kind %q", s.APIVersion, s.Kind)
+	}
+	if s.InstanceDelays.CreateMax != 3 || s.StartupTaints[0].RemovalDelayMax != 3 {
+		t.Errorf("expected unversioned delay maximums to be migrated, got %+v and %+v", s.InstanceDelays, s.StartupTaints[0])
+	}
+
+	for _, data := range []string{
+		"apiVersion: virtual.gardener.cloud/v9\n",
+		"apiVersion: virtual.gardener.cloud/v1alpha1\nkind: ConfigMap\n",
+		"Quotas: [",
+	} {
+		if _, err = DecodeSimulationConfig([]byte(data)); !errors.Is(err, ErrInvalidSimulationConfig) {
+			t.Errorf("DecodeSimulationConfig(%q) err = %v, want %v", data, err, ErrInvalidSimulationConfig)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package virtual
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// RootFilesystemOverhead is the fraction of the root volume consumed by the filesystem metadata and journal, which
+// makes a 50Gi root volume report an ephemeral-storage capacity of about 50225972Ki.
+const RootFilesystemOverhead = 0.042
+
+// volumeSizeLimitsGiB holds the minimum and maximum size in GiB of the EBS volume types.
+var volumeSizeLimitsGiB = map[string][2]int64{
+	"gp2":      {1, 16384},
+	"gp3":      {1, 16384},
+	"io1":      {4, 16384},
+	"io2":      {4, 65536},
+	"st1":      {125, 16384},
+	"sc1":      {125, 16384},
+	"standard": {1, 1024},
+}
+
+// nonBootVolumeTypes are the EBS volume types that cannot be used as root volume.
+var nonBootVolumeTypes = []string{"st1", "sc1"}
+
+// rootBlockDevice returns the block device of the providerSpec without a device name, which is the root device.
+func rootBlockDevice(providerSpec *awsfake.AWSProviderSpec) (blockDevice awsfake.AWSBlockDeviceMappingSpec, ok bool) {
+	idx := slices.IndexFunc(providerSpec.BlockDevices, func(bd awsfake.AWSBlockDeviceMappingSpec) bool {
+		return bd.DeviceName == ""
+	})
+	if idx < 0 {
+		return
+	}
+	return providerSpec.BlockDevices[idx], true
+}
+
+// rootEphemeralStorage returns the ephemeral-storage capacity of a node whose kubelet root filesystem lives on the
+// root block device of the providerSpec. Volumes whose type or size EC2 would reject result in an error.
+func rootEphemeralStorage(providerSpec *awsfake.AWSProviderSpec) (capacity resource.Quantity, ok bool, err error) {
+	rootDevice, ok := rootBlockDevice(providerSpec)
+	if !ok {
+		return
+	}
+	volumeType := rootDevice.Ebs.VolumeType
+	if slices.Contains(nonBootVolumeTypes, volumeType) {
+		err = fmt.Errorf("InvalidParameterCombination: %s volumes cannot be used as boot volumes", volumeType)
+		return
+	}
+	sizeGiB := rootDevice.Ebs.VolumeSize
+	if limits, found := volumeSizeLimitsGiB[volumeType]; found && (sizeGiB < limits[0] || sizeGiB > limits[1]) {
+		err = fmt.Errorf("InvalidParameterValue: volume size %dGiB of volume type %s must be between %dGiB and %dGiB", sizeGiB, volumeType, limits[0], limits[1])
+		return
+	}
+	sizeKi := sizeGiB * 1024 * 1024
+	capacity = *resource.NewQuantity(int64(float64(sizeKi)*(1-RootFilesystemOverhead))*1024, resource.BinarySI)
+	return
+}
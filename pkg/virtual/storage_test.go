@@ -0,0 +1,55 @@
+package virtual
+
+import (
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+)
+
+func TestRootEphemeralStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		devices     []awsfake.AWSBlockDeviceMappingSpec
+		wantOK      bool
+		wantErr     bool
+		wantStorage string
+	}{
+		{name: "no block devices"},
+		{
+			name:    "only data volume",
+			devices: []awsfake.AWSBlockDeviceMappingSpec{{DeviceName: "/dev/sdf", Ebs: awsfake.AWSEbsBlockDeviceSpec{VolumeSize: 100, VolumeType: "gp3"}}},
+		},
+		{
+			name:        "gp3 root volume",
+			devices:     []awsfake.AWSBlockDeviceMappingSpec{{Ebs: awsfake.AWSEbsBlockDeviceSpec{VolumeSize: 50, VolumeType: "gp3"}}},
+			wantOK:      true,
+			wantStorage: "50226790Ki",
+		},
+		{
+			name:    "st1 root volume",
+			devices: []awsfake.AWSBlockDeviceMappingSpec{{Ebs: awsfake.AWSEbsBlockDeviceSpec{VolumeSize: 500, VolumeType: "st1"}}},
+			wantOK:  true,
+			wantErr: true,
+		},
+		{
+			name:    "standard root volume too large",
+			devices: []awsfake.AWSBlockDeviceMappingSpec{{Ebs: awsfake.AWSEbsBlockDeviceSpec{VolumeSize: 2048, VolumeType: "standard"}}},
+			wantOK:  true,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			storage, ok, err := rootEphemeralStorage(&awsfake.AWSProviderSpec{BlockDevices: tc.devices})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("rootEphemeralStorage() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if ok != tc.wantOK {
+				t.Fatalf("rootEphemeralStorage() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if tc.wantStorage != "" && storage.String() != tc.wantStorage {
+				t.Errorf("rootEphemeralStorage() = %s, want %s", storage.String(), tc.wantStorage)
+			}
+		})
+	}
+}
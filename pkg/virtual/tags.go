@@ -0,0 +1,85 @@
+package virtual
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationInstanceTags is the node annotation holding the JSON encoded EC2 tags of the instance backing the node.
+	AnnotationInstanceTags = "virtual.gardener.cloud/instance-tags"
+
+	// TagName is the EC2 tag holding the name of the machine of an instance.
+	TagName = "Name"
+	// TagMachineClass is the EC2 tag holding the name of the MachineClass an instance was created for.
+	TagMachineClass = "virtual.gardener.cloud/machine-class"
+
+	tagPrefixCluster = "kubernetes.io/cluster/"
+	tagPrefixRole    = "kubernetes.io/role/"
+)
+
+// instanceTags returns the tags of an instance for the machine with the given name launched with the given
+// providerSpec of the MachineClass with the given name.
+func instanceTags(providerSpec *awsfake.AWSProviderSpec, machineName, machineClassName string) map[string]string {
+	tags := maps.Clone(providerSpec.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags[TagName] = machineName
+	tags[TagMachineClass] = machineClassName
+	return tags
+}
+
+// setInstanceTags records the given instance tags on the node.
+func setInstanceTags(node *corev1.Node, tags map[string]string) error {
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return fmt.Errorf("cannot encode tags of node %q: %w", node.Name, err)
+	}
+	node.Annotations[AnnotationInstanceTags] = string(data)
+	return nil
+}
+
+// instanceTagsOf returns the tags of the instance backing the given node. Nodes not created by the virtual provider
+// have no tags.
+func instanceTagsOf(node corev1.Node) (tags map[string]string, ok bool) {
+	data, ok := node.Annotations[AnnotationInstanceTags]
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, false
+	}
+	return tags, true
+}
+
+// clusterAndRoleTagKeys returns the kubernetes.io/cluster/ and kubernetes.io/role/ tag keys of the providerSpec, which
+// the AWS provider filters instances by.
+func clusterAndRoleTagKeys(providerSpec *awsfake.AWSProviderSpec) (clusterTagKey, roleTagKey string) {
+	for key := range providerSpec.Tags {
+		if strings.Contains(key, tagPrefixCluster) {
+			clusterTagKey = key
+		} else if strings.Contains(key, tagPrefixRole) {
+			roleTagKey = key
+		}
+	}
+	return
+}
+
+// ownedBy reports whether the instance of the given node carries the cluster and role tags of the providerSpec and
+// was created for the MachineClass with the given name.
+func ownedBy(node corev1.Node, providerSpec *awsfake.AWSProviderSpec, machineClassName string) bool {
+	tags, ok := instanceTagsOf(node)
+	if !ok {
+		return false
+	}
+	clusterTagKey, roleTagKey := clusterAndRoleTagKeys(providerSpec)
+	_, hasClusterTag := tags[clusterTagKey]
+	_, hasRoleTag := tags[roleTagKey]
+	return hasClusterTag && hasRoleTag && tags[TagMachineClass] == machineClassName
+}
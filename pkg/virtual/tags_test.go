@@ -0,0 +1,69 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/elankath/machine-controller-manager-provider-virtual/pkg/virtual/awsfake"
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListMachinesScopedToMachineClass(t *testing.T) {
+	providerSpec := &awsfake.AWSProviderSpec{Tags: map[string]string{
+		"kubernetes.io/cluster/shoot--dev--test": "1",
+		"kubernetes.io/role/node":                "1",
+	}}
+	otherClusterSpec := &awsfake.AWSProviderSpec{Tags: map[string]string{
+		"kubernetes.io/cluster/shoot--dev--other": "1",
+		"kubernetes.io/role/node":                 "1",
+	}}
+	newTaggedNode := func(machineName, className string, spec *awsfake.AWSProviderSpec, state InstanceState) corev1.Node {
+		node := corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        machineName,
+				Labels:      map[string]string{LabelMachineName: machineName},
+				Annotations: map[string]string{AnnotationInstanceState: string(state)},
+			},
+			Spec: corev1.NodeSpec{ProviderID: "aws:///eu-west-1/i-" + machineName},
+		}
+		if err := setInstanceTags(&node, instanceTags(spec, machineName, className)); err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	nodes := []corev1.Node{
+		newTaggedNode("a-1", "class-a", providerSpec, InstanceStateRunning),
+		newTaggedNode("a-2", "class-a", providerSpec, InstanceStateShuttingDown),
+		newTaggedNode("b-1", "class-b", providerSpec, InstanceStateRunning),
+		newTaggedNode("o-1", "class-a", otherClusterSpec, InstanceStateRunning),
+		{ObjectMeta: metav1.ObjectMeta{Name: "foreign"}, Spec: corev1.NodeSpec{ProviderID: "aws:///eu-west-1/i-foreign"}},
+	}
+	d := &DriverImpl{client: fake.NewClientset(), managedNodes: make(map[string]corev1.Node)}
+	for _, n := range nodes {
+		d.managedNodes[n.Name] = n
+	}
+	raw, err := json.Marshal(providerSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := d.ListMachines(context.Background(), &driver.ListMachinesRequest{
+		MachineClass: &v1alpha1.MachineClass{ObjectMeta: metav1.ObjectMeta{Name: "class-a"}, ProviderSpec: runtime.RawExtension{Raw: raw}},
+		Secret: &corev1.Secret{Data: map[string][]byte{
+			awsfake.AWSAccessKeyID: []byte("AKIA"), awsfake.AWSSecretAccessKey: []byte("secret"), awsfake.UserData: []byte("#!/bin/bash"),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Collect(maps.Values(resp.MachineList)); len(got) != 1 || got[0] != "a-1" {
+		t.Errorf("ListMachines() = %v, want only machine a-1", resp.MachineList)
+	}
+}
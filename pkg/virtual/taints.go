@@ -0,0 +1,110 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// TaintExternalCloudProvider is the taint a kubelet with an external cloud provider registers the node with until
+// the cloud-controller-manager initializes it.
+const TaintExternalCloudProvider = "node.cloudprovider.kubernetes.io/uninitialized"
+
+// StartupTaint is a taint that a node registers with and that is removed after a random delay between
+// RemovalDelayMin and RemovalDelayMax seconds once the node has joined the cluster.
+type StartupTaint struct {
+	Key             string
+	Value           string `json:",omitempty"`
+	Effect          corev1.TaintEffect
+	RemovalDelayMin int64
+	RemovalDelayMax int64
+}
+
+// DefaultStartupTaints returns the startup taints used when the SimulationConfig does not specify any.
+func DefaultStartupTaints() []StartupTaint {
+	return []StartupTaint{
+		{Key: corev1.TaintNodeNotReady, Effect: corev1.TaintEffectNoSchedule},
+		{Key: TaintExternalCloudProvider, Value: "true", Effect: corev1.TaintEffectNoSchedule, RemovalDelayMin: 1, RemovalDelayMax: 2},
+	}
+}
+
+// Taint returns the StartupTaint as a corev1.Taint.
+func (s StartupTaint) Taint() corev1.Taint {
+	return corev1.Taint{Key: s.Key, Value: s.Value, Effect: s.Effect}
+}
+
+// applyNodeTemplateSpec applies the labels, annotations and taints of the NodeTemplateSpec of the machine to the node.
+func applyNodeTemplateSpec(node *corev1.Node, machine *v1alpha1.Machine) {
+	nodeTemplateSpec := machine.Spec.NodeTemplateSpec
+	for k, v := range nodeTemplateSpec.Labels {
+		node.Labels[k] = v
+	}
+	for k, v := range nodeTemplateSpec.Annotations {
+		node.Annotations[k] = v
+	}
+	for _, t := range nodeTemplateSpec.Spec.Taints {
+		node.Spec.Taints = addTaint(node.Spec.Taints, t)
+	}
+}
+
+// addStartupTaints adds the given startup taints to the node.
+func addStartupTaints(node *corev1.Node, startupTaints []StartupTaint) {
+	for _, s := range startupTaints {
+		node.Spec.Taints = addTaint(node.Spec.Taints, s.Taint())
+	}
+}
+
+func addTaint(taints []corev1.Taint, taint corev1.Taint) []corev1.Taint {
+	if slices.ContainsFunc(taints, func(t corev1.Taint) bool { return t.MatchTaint(&taint) }) {
+		return taints
+	}
+	return append(taints, taint)
+}
+
+// scheduleStartupTaintRemoval removes each of the given startup taints from the node after its removal delay.
+func scheduleStartupTaintRemoval(client kubernetes.Interface, nodeName string, startupTaints []StartupTaint) {
+	for _, s := range startupTaints {
+		var delay time.Duration
+		if s.RemovalDelayMax > 0 {
+			delay = randomDuration(s.RemovalDelayMin, s.RemovalDelayMax)
+		}
+		klog.Infof("Removing startup taint %q from node %q after %s", s.Key, nodeName, delay)
+		time.AfterFunc(delay, func() {
+			err := removeNodeTaint(context.Background(), client, nodeName, s.Taint())
+			if err != nil {
+				klog.Errorf("Failed to remove startup taint %q from node %q: %v", s.Key, nodeName, err)
+			}
+		})
+	}
+}
+
+// removeNodeTaint removes the taint matching the key and effect of the given taint from the node.
+func removeNodeTaint(ctx context.Context, client kubernetes.Interface, nodeName string, taint corev1.Taint) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("cannot get node %q: %w", nodeName, err)
+		}
+		numTaints := len(node.Spec.Taints)
+		node.Spec.Taints = slices.DeleteFunc(node.Spec.Taints, func(t corev1.Taint) bool {
+			return t.MatchTaint(&taint)
+		})
+		if len(node.Spec.Taints) == numTaints {
+			return nil
+		}
+		_, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		klog.Infof("Removed taint %q from node %q", taint.Key, nodeName)
+		return nil
+	})
+}
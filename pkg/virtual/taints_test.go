@@ -0,0 +1,47 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyNodeTemplateSpecAndRemoveStartupTaints(t *testing.T) {
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "m1"}}
+	machine.Spec.NodeTemplateSpec.Labels = map[string]string{"pool": "gpu"}
+	machine.Spec.NodeTemplateSpec.Annotations = map[string]string{"note": "x"}
+	machine.Spec.NodeTemplateSpec.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "m1", Labels: map[string]string{}, Annotations: map[string]string{}}}
+
+	applyNodeTemplateSpec(&node, machine)
+	addStartupTaints(&node, DefaultStartupTaints())
+
+	if node.Labels["pool"] != "gpu" || node.Annotations["note"] != "x" {
+		t.Errorf("expected labels and annotations of NodeTemplateSpec, got %v and %v", node.Labels, node.Annotations)
+	}
+	if len(node.Spec.Taints) != 3 {
+		t.Fatalf("expected 3 taints, got %v", node.Spec.Taints)
+	}
+
+	client := fake.NewClientset(&node)
+	err := removeNodeTaint(context.Background(), client, node.Name, corev1.Taint{Key: TaintExternalCloudProvider, Effect: corev1.TaintEffectNoSchedule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := client.CoreV1().Nodes().Get(context.Background(), node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, taint := range updated.Spec.Taints {
+		if taint.Key == TaintExternalCloudProvider {
+			t.Errorf("expected taint %q to be removed", TaintExternalCloudProvider)
+		}
+	}
+	if len(updated.Spec.Taints) != 2 {
+		t.Errorf("expected 2 remaining taints, got %v", updated.Spec.Taints)
+	}
+}
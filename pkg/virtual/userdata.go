@@ -0,0 +1,274 @@
+package virtual
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// KubeletUserData holds the kubelet settings relevant for node registration found in the userData of a machine.
+type KubeletUserData struct {
+	MaxPods            int64
+	NodeLabels         map[string]string
+	RegisterWithTaints []corev1.Taint
+	KubeReserved       corev1.ResourceList
+	SystemReserved     corev1.ResourceList
+	EvictionHard       map[string]string
+}
+
+// cloudConfig is the part of a cloud-init cloud-config relevant for finding the kubelet configuration.
+type cloudConfig struct {
+	WriteFiles []struct {
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	} `json:"write_files"`
+}
+
+// kubeletConfiguration is the part of the kubelet.config.k8s.io KubeletConfiguration relevant for node registration.
+type kubeletConfiguration struct {
+	Kind               string            `json:"kind"`
+	MaxPods            int64             `json:"maxPods"`
+	KubeReserved       map[string]string `json:"kubeReserved"`
+	SystemReserved     map[string]string `json:"systemReserved"`
+	EvictionHard       map[string]string `json:"evictionHard"`
+	RegisterWithTaints []corev1.Taint    `json:"registerWithTaints"`
+}
+
+var kubeletFlagRegexp = regexp.MustCompile(`--(max-pods|node-labels|register-with-taints|kube-reserved|system-reserved|eviction-hard)[= ]("[^"]*"|'[^']*'|[^\s\\]+)`)
+
+// ParseKubeletUserData extracts the kubelet settings from the given userData, which is either a cloud-config whose
+// write_files carry the kubelet configuration and unit, or a shell script writing them via here-documents. As with
+// the kubelet, command line flags take precedence over the KubeletConfiguration file.
+func ParseKubeletUserData(userData []byte) (k KubeletUserData, err error) {
+	files, err := userDataFiles(userData)
+	if err != nil {
+		return
+	}
+	for _, content := range files {
+		if !strings.Contains(content, "kind: KubeletConfiguration") {
+			continue
+		}
+		var kc kubeletConfiguration
+		err = yaml.Unmarshal([]byte(content), &kc)
+		if err != nil {
+			err = fmt.Errorf("cannot parse KubeletConfiguration: %w", err)
+			return
+		}
+		if kc.Kind != "KubeletConfiguration" {
+			continue
+		}
+		k.MaxPods = kc.MaxPods
+		k.RegisterWithTaints = kc.RegisterWithTaints
+		k.EvictionHard = kc.EvictionHard
+		if k.KubeReserved, err = toResources(kc.KubeReserved); err != nil {
+			return
+		}
+		if k.SystemReserved, err = toResources(kc.SystemReserved); err != nil {
+			return
+		}
+	}
+	for _, content := range append(files, string(userData)) {
+		for _, match := range kubeletFlagRegexp.FindAllStringSubmatch(content, -1) {
+			err = k.applyFlag(match[1], strings.Trim(match[2], `"'`))
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (k *KubeletUserData) applyFlag(name, value string) (err error) {
+	switch name {
+	case "max-pods":
+		k.MaxPods, err = strconv.ParseInt(value, 10, 64)
+	case "node-labels":
+		k.NodeLabels, err = parseKeyValues(value, "=")
+	case "register-with-taints":
+		k.RegisterWithTaints, err = parseTaints(value)
+	case "kube-reserved", "system-reserved":
+		var kv map[string]string
+		var resources corev1.ResourceList
+		if kv, err = parseKeyValues(value, "="); err != nil {
+			break
+		}
+		if resources, err = toResources(kv); err != nil {
+			break
+		}
+		if name == "kube-reserved" {
+			k.KubeReserved = resources
+		} else {
+			k.SystemReserved = resources
+		}
+	case "eviction-hard":
+		k.EvictionHard, err = parseKeyValues(value, "<")
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid kubelet flag --%s=%s: %w", name, value, err)
+	}
+	return
+}
+
+// Apply applies the max-pods, node-labels and register-with-taints of the KubeletUserData to the node.
+func (k KubeletUserData) Apply(node *corev1.Node) {
+	if k.MaxPods > 0 {
+		node.Status.Capacity[corev1.ResourcePods] = *resource.NewQuantity(k.MaxPods, resource.DecimalSI)
+	}
+	maps.Copy(node.Labels, k.NodeLabels)
+	for _, t := range k.RegisterWithTaints {
+		node.Spec.Taints = addTaint(node.Spec.Taints, t)
+	}
+}
+
+// Overlay returns the given KubeletReservation overlaid with the reservations of the KubeletUserData.
+func (k KubeletUserData) Overlay(r KubeletReservation) KubeletReservation {
+	if k.KubeReserved != nil {
+		r.KubeReserved = k.KubeReserved
+	}
+	if k.SystemReserved != nil {
+		r.SystemReserved = k.SystemReserved
+	}
+	if k.EvictionHard != nil {
+		r.EvictionHard = k.EvictionHard
+	}
+	return r
+}
+
+// userDataFiles returns the contents of the files written by the given userData.
+func userDataFiles(userData []byte) (files []string, err error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(userData), []byte("#cloud-config")) {
+		return hereDocuments(string(userData)), nil
+	}
+	var cc cloudConfig
+	err = yaml.Unmarshal(userData, &cc)
+	if err != nil {
+		err = fmt.Errorf("cannot parse cloud-config: %w", err)
+		return
+	}
+	for _, f := range cc.WriteFiles {
+		var content []byte
+		content, err = decodeFileContent(f.Content, f.Encoding)
+		if err != nil {
+			err = fmt.Errorf("cannot decode content of file %q: %w", f.Path, err)
+			return
+		}
+		files = append(files, string(content))
+	}
+	return
+}
+
+// decodeFileContent decodes the content of a cloud-config write_files entry as per its encoding.
+func decodeFileContent(content, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "text/plain":
+		return []byte(content), nil
+	case "b64", "base64":
+		return base64.StdEncoding.DecodeString(content)
+	case "gz+b64", "gzip+b64", "gz+base64", "gzip+base64":
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// hereDocuments returns the bodies of the here-documents of the given shell script.
+func hereDocuments(script string) (docs []string) {
+	var delimiter string
+	var doc strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if delimiter != "" {
+			if strings.TrimSpace(line) == delimiter {
+				docs = append(docs, doc.String())
+				delimiter = ""
+				doc.Reset()
+				continue
+			}
+			doc.WriteString(line)
+			doc.WriteString("\n")
+			continue
+		}
+		_, rest, ok := strings.Cut(line, "<<")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(rest, "-"))
+		if len(fields) > 0 {
+			delimiter = strings.Trim(fields[0], `"'`)
+		}
+	}
+	return
+}
+
+// parseKeyValues parses a comma separated list of key<sep>value pairs.
+func parseKeyValues(s, sep string) (kv map[string]string, err error) {
+	kv = make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, sep)
+		if !ok {
+			err = fmt.Errorf("%q is not of the form key%svalue", pair, sep)
+			return
+		}
+		kv[k] = v
+	}
+	return
+}
+
+// parseTaints parses a comma separated list of taints of the form key=value:Effect or key:Effect.
+func parseTaints(s string) (taints []corev1.Taint, err error) {
+	for _, spec := range strings.Split(s, ",") {
+		if spec == "" {
+			continue
+		}
+		keyValue, effect, ok := strings.Cut(spec, ":")
+		if !ok {
+			err = fmt.Errorf("taint %q has no effect", spec)
+			return
+		}
+		key, value, _ := strings.Cut(keyValue, "=")
+		taints = append(taints, corev1.Taint{Key: key, Value: value, Effect: corev1.TaintEffect(effect)})
+	}
+	return
+}
+
+func toResources(kv map[string]string) (resources corev1.ResourceList, err error) {
+	if kv == nil {
+		return
+	}
+	resources = make(corev1.ResourceList, len(kv))
+	for name, value := range kv {
+		var q resource.Quantity
+		q, err = resource.ParseQuantity(value)
+		if err != nil {
+			err = fmt.Errorf("invalid quantity %q for resource %q: %w", value, name, err)
+			return
+		}
+		resources[corev1.ResourceName(name)] = q
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package virtual
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const kubeletConfigurationYAML = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 64
+kubeReserved:
+  cpu: 80m
+  memory: 1Gi
+evictionHard:
+  memory.available: 200Mi
+registerWithTaints:
+- key: dedicated
+  value: gpu
+  effect: NoSchedule
+`
+
+func gzipBase64(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestParseKubeletUserData(t *testing.T) {
+	cloudConfig := "#cloud-config\nwrite_files:\n" +
+		"- path: /var/lib/kubelet/config/kubelet\n  encoding: gzip+b64\n  content: " + gzipBase64(t, kubeletConfigurationYAML) + "\n" +
+		"- path: /etc/systemd/system/kubelet.service\n  encoding: b64\n  content: " +
+		base64.StdEncoding.EncodeToString([]byte("ExecStart=/opt/bin/kubelet --max-pods=110 --node-labels=worker.gardener.cloud/pool=gpu,team=ml \\\n    --config=/var/lib/kubelet/config/kubelet\n")) + "\n"
+	script := "#!/bin/bash\ncat <<'EOF' > /var/lib/kubelet/config/kubelet\n" + kubeletConfigurationYAML + "EOF\n" +
+		"/opt/bin/kubelet --register-with-taints=a=b:NoExecute,c:NoSchedule --kube-reserved cpu=100m,memory=2Gi\n"
+
+	t.Run("cloud-config", func(t *testing.T) {
+		k, err := ParseKubeletUserData([]byte(cloudConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.MaxPods != 110 {
+			t.Errorf("MaxPods = %d, want 110 from the kubelet flag", k.MaxPods)
+		}
+		if k.NodeLabels[LabelWorkerPool] != "gpu" || k.NodeLabels["team"] != "ml" {
+			t.Errorf("NodeLabels = %v", k.NodeLabels)
+		}
+		if len(k.RegisterWithTaints) != 1 || k.RegisterWithTaints[0].Key != "dedicated" {
+			t.Errorf("RegisterWithTaints = %v", k.RegisterWithTaints)
+		}
+		if mem := k.KubeReserved[corev1.ResourceMemory]; mem.Cmp(resource.MustParse("1Gi")) != 0 {
+			t.Errorf("KubeReserved memory = %s, want 1Gi", mem.String())
+		}
+		if k.EvictionHard[EvictionSignalMemoryAvailable] != "200Mi" {
+			t.Errorf("EvictionHard = %v", k.EvictionHard)
+		}
+	})
+
+	t.Run("script", func(t *testing.T) {
+		k, err := ParseKubeletUserData([]byte(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.MaxPods != 64 {
+			t.Errorf("MaxPods = %d, want 64 from the KubeletConfiguration", k.MaxPods)
+		}
+		if len(k.RegisterWithTaints) != 2 || k.RegisterWithTaints[0].Value != "b" || k.RegisterWithTaints[1].Effect != corev1.TaintEffectNoSchedule {
+			t.Errorf("RegisterWithTaints = %v", k.RegisterWithTaints)
+		}
+		if mem := k.KubeReserved[corev1.ResourceMemory]; mem.Cmp(resource.MustParse("2Gi")) != 0 {
+			t.Errorf("KubeReserved memory = %s, want 2Gi", mem.String())
+		}
+	})
+
+	t.Run("invalid flag", func(t *testing.T) {
+		if _, err := ParseKubeletUserData([]byte("kubelet --max-pods=many")); err == nil {
+			t.Error("expected error for invalid --max-pods")
+		}
+	})
+}
@@ -5,10 +5,11 @@ import (
 	"context"
 	crand "crypto/rand" // ← preferred alias
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	rand "math/rand/v2"
+	"net/netip"
 	"os"
 	"slices"
 	"sync"
@@ -24,9 +25,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 )
 
@@ -37,21 +40,38 @@ const (
 	QuotaMachineTypeFmt = QuotaPrefixFmt + "_MACHINE_TYPE"
 	QuotaRegionFmt      = QuotaPrefixFmt + "_REGION"
 	QuotaAmountFmt      = QuotaPrefixFmt + "_AMOUNT"
+
+	// DefaultEphemeralStorageCapacity is used when neither the providerSpec has a root block device nor the
+	// NodeTemplate carries an ephemeral-storage capacity.
+	DefaultEphemeralStorageCapacity = "50225972Ki"
+	// LabelMachineName is the node label holding the name of the machine backing the node.
+	LabelMachineName = "node.gardener.cloud/machine-name"
+	// DefaultArchitecture is used when neither the NodeTemplate nor the instance type catalog specify an architecture.
+	DefaultArchitecture = "amd64"
 )
 
-var SimulationConfigPath = "gen/simulation-config.json"
 var _ driver.Driver = &DriverImpl{}
 
 // DriverImpl is the struct that implements the MCM driver.Driver interface
 type DriverImpl struct {
-	mu                  sync.Mutex
-	clientConfig        *rest.Config
-	client              *kubernetes.Clientset
-	machineClient       machineclientset.Interface
-	shootNamespace      string
-	managedNodes        map[string]corev1.Node
+	mu             sync.Mutex
+	clientConfig   *rest.Config
+	client         kubernetes.Interface
+	machineClient  machineclientset.Interface
+	shootNamespace string
+	managedNodes   map[string]corev1.Node
+	// unjoinedInstances holds the nodes of instances simulated to never register, keyed by node name. They are part of
+	// the managedNodes though they do not exist in the cluster.
+	unjoinedInstances map[string]corev1.Node
+	// firedInstanceEvents holds the ScheduledInstanceEvents already simulated, keyed by their string representation.
+	firedInstanceEvents map[string]bool
 	simConfig           SimulationConfig
+	// simConfigVersion is the resource version of the SimulationConfig ConfigMap the simConfig was loaded from.
+	simConfigVersion    string
 	lastSimConfigChange time.Time
+	instanceTypes       InstanceTypeCatalog
+	kubeletConfig       KubeletConfig
+	machineImages       MachineImageCatalog
 }
 
 type QuotaLookup struct {
@@ -59,12 +79,64 @@ type QuotaLookup struct {
 	RegionName  string
 }
 
+// SimulationConfig configures the simulation. Its APIVersion is the SimulationConfigAPIVersion once decoded via
+// DecodeSimulationConfig.
 type SimulationConfig struct {
+	APIVersion     string `json:"apiVersion,omitempty"`
+	Kind           string `json:"kind,omitempty"`
 	Quotas         []Quota
 	InstanceDelays InstanceDelays
+	// StartupTaints are the taints nodes register with. DefaultStartupTaints are used if nil.
+	StartupTaints []StartupTaint
+	// RevokedCredentials are the AWS access keys whose use fails with an authentication error.
+	RevokedCredentials []RevokedCredential `json:",omitempty"`
+	// Network holds the subnets of the zones and the pod range used to assign node and pod IPs.
+	Network NetworkConfig
+	// DuplicateInstanceProbability is the probability between 0 and 1 with which a CreateMachine call for a machine
+	// whose instance already exists creates another instance instead of returning the existing one.
+	DuplicateInstanceProbability float64 `json:",omitempty"`
+	// StuckTerminationProbability is the probability between 0 and 1 with which an instance being deleted remains
+	// shutting-down forever.
+	StuckTerminationProbability float64 `json:",omitempty"`
+	// CloudControllerManager configures the simulated cloud-controller-manager.
+	CloudControllerManager CloudControllerManagerConfig
+	// JoinFailures simulate instances that never join the cluster. The first JoinFailure matching an instance applies.
+	JoinFailures []JoinFailure `json:",omitempty"`
+	// NodeNaming is either NodeNamingMachineName (the default) or NodeNamingPrivateDNSName.
+	NodeNaming string `json:",omitempty"`
+	// InstanceEvents are the reboot, stop, retirement and shutdown events simulated once their time has come.
+	InstanceEvents []ScheduledInstanceEvent `json:",omitempty"`
+	// NodeShutdown configures the graceful and non-graceful node shutdowns simulated by the shutdown and
+	// non-graceful-shutdown instance events.
+	NodeShutdown NodeShutdownConfig
+	// Spot simulates the insufficient capacity and interruptions of spot instances, which are the instances whose
+	// providerSpec sets a SpotPrice. It is usually set by Overrides for spot worker pools only.
+	Spot *SpotConfig `json:",omitempty"`
+	// QuotaSync configures the quotas synced from the MachineClasses.
+	QuotaSync QuotaSyncConfig
+	// Overrides override parts of the SimulationConfig for the instances of certain MachineClasses, MachineDeployments
+	// or instance types.
+	Overrides []SimulationOverride `json:",omitempty"`
+}
+
+// GetStartupTaints returns the StartupTaints of the SimulationConfig or the DefaultStartupTaints if unset.
+func (s SimulationConfig) GetStartupTaints() []StartupTaint {
+	if s.StartupTaints == nil {
+		return DefaultStartupTaints()
+	}
+	return s.StartupTaints
 }
 
-// InstanceDelays represents the minimum and maximum delays in seconds taken to create, initialize or join instance to cluster.
+const (
+	// NodeNamingMachineName names nodes after their machine.
+	NodeNamingMachineName = "MachineName"
+	// NodeNamingPrivateDNSName names nodes after the private DNS name of their instance like real AWS nodes, leaving the
+	// LabelMachineName as the only link to their machine.
+	NodeNamingPrivateDNSName = "PrivateDNSName"
+)
+
+// InstanceDelays represents the minimum and maximum delays in seconds taken to create, initialize or join instance to cluster
+// and the time an instance is shutting down before it is terminated or rebooting before its node is Ready again.
 // The real value will be randomized between minimum and maximum
 type InstanceDelays struct {
 	CreateMin     int64
@@ -75,6 +147,8 @@ type InstanceDelays struct {
 	JoinMax       int64
 	DeleteMin     int64
 	DeleteMax     int64
+	RebootMin     int64 `json:",omitempty"`
+	RebootMax     int64 `json:",omitempty"`
 }
 
 type Quota struct {
@@ -105,11 +179,31 @@ func NewDriver(ctx context.Context, kubeconfig string, shootNamespace string) (d
 	if err != nil {
 		return nil, fmt.Errorf("cannot create machine client: %w", err)
 	}
+	instanceTypes, err := LoadInstanceTypeCatalog(InstanceTypeCatalogPath)
+	if err != nil {
+		return nil, err
+	}
+	kubeletConfig, err := LoadKubeletConfig(KubeletConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if kubeletConfig.Version == "" {
+		klog.Warningf("Kubelet config %q has no kubernetes version of the shoot - nodes report no kubelet version until 'dev setup' generates it", KubeletConfigPath)
+	}
+	machineImages, err := LoadMachineImageCatalog(MachineImageCatalogPath)
+	if err != nil {
+		return nil, err
+	}
 	d := &DriverImpl{clientConfig: config,
-		client:         clientset,
-		machineClient:  machineClient,
-		shootNamespace: shootNamespace,
-		managedNodes:   make(map[string]corev1.Node)}
+		client:              clientset,
+		machineClient:       machineClient,
+		shootNamespace:      shootNamespace,
+		managedNodes:        make(map[string]corev1.Node),
+		unjoinedInstances:   make(map[string]corev1.Node),
+		firedInstanceEvents: make(map[string]bool),
+		instanceTypes:       instanceTypes,
+		kubeletConfig:       kubeletConfig,
+		machineImages:       machineImages}
 	err = d.reloadNodes(ctx)
 	if err != nil {
 		return nil, err
@@ -118,7 +212,11 @@ func NewDriver(ctx context.Context, kubeconfig string, shootNamespace string) (d
 	if err != nil {
 		return nil, err
 	}
-	go d.watchSimulationConfig()
+	d.resumeTerminations()
+	go d.watchSimulationConfig(ctx)
+	go d.watchMachineClasses(ctx)
+	go d.runCloudControllerManager(ctx)
+	go d.runInstanceEvents(ctx)
 	return d, nil
 }
 
@@ -131,106 +229,67 @@ func (d *DriverImpl) reloadNodes(ctx context.Context) error {
 	for _, n := range nodeList.Items {
 		d.managedNodes[n.Name] = n
 	}
+	maps.Copy(d.managedNodes, d.unjoinedInstances)
 	return nil
 }
 
-func (d *DriverImpl) createSimulationConfig(ctx context.Context) error {
-	if FileExists(SimulationConfigPath) {
-		klog.Infof("Simlulation Config already exists at %q - loading", SimulationConfigPath)
-		return d.refreshSimulationConfig()
+// nodeForMachine returns the managed node of the machine with the given name, which is found via the
+// LabelMachineName as node names need not match machine names. If a machine has several nodes, e.g. due to duplicate
+// instances, the node of an existing instance is preferred over those of shutting down or terminated instances, then
+// the newest node and finally the one with the lowest name, so that the choice does not depend on map iteration order.
+func (d *DriverImpl) nodeForMachine(machineName string) (node corev1.Node, ok bool) {
+	for _, n := range d.managedNodes {
+		if machineNameOf(n) != machineName {
+			continue
+		}
+		if !ok || preferNode(n, node) {
+			node, ok = n, true
+		}
 	}
+	return
+}
 
-	machineIf := d.machineClient.MachineV1alpha1()
-	machineClassList, err := machineIf.MachineClasses(d.shootNamespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
+// preferNode returns whether node a is preferred over node b of the same machine by nodeForMachine.
+func preferNode(a, b corev1.Node) bool {
+	if aExists, bExists := instanceExists(instanceStateOf(a)), instanceExists(instanceStateOf(b)); aExists != bExists {
+		return aExists
 	}
-	var nt *v1alpha1.NodeTemplate
-	//var quotaKeys = sets.New[string]()
-	mccItems := machineClassList.Items
-	slices.SortFunc(mccItems, func(a, b v1alpha1.MachineClass) int {
-		return cmp.Compare(a.Name, b.Name)
-	})
-	var quotas []Quota
-	for i := 0; i < len(mccItems); i++ {
-		nt = mccItems[i].NodeTemplate
-		quotas = append(quotas, Quota{
-			//MachineTypeKey: machineypeKey,
-			MachineType: nt.InstanceType,
-			//RegionKey:      regionKey,
-			Region: nt.Region,
-			//AmountKey:      amountKey,
-			Amount: 10,
-		})
-	}
-	d.simConfig.Quotas = quotas
-	d.simConfig.InstanceDelays = InstanceDelays{
-		CreateMin:     1,
-		CreateMax:     2,
-		InitializeMin: 1,
-		InitializeMax: 2,
-		JoinMin:       2,
-		JoinMax:       4,
-		DeleteMin:     1,
-		DeleteMax:     2,
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return b.CreationTimestamp.Before(&a.CreationTimestamp)
 	}
-	data, err := json.MarshalIndent(d.simConfig, "", "  ")
-	if err != nil {
-		return err
-	}
-	err = os.WriteFile(SimulationConfigPath, data, 0755)
-	if err != nil {
-		return err
-	}
-	d.lastSimConfigChange = time.Now().UTC()
-	klog.Infof("createSimulationConfig wrote SimulationConfig at %q", SimulationConfigPath)
-	return nil
+	return a.Name < b.Name
 }
 
-func hasSimulationConfigChanged(markTime time.Time) bool {
-	fileInfo, err := os.Stat(SimulationConfigPath)
-	if err != nil {
-		klog.Errorf("cannot fetch file info for %q: %v", SimulationConfigPath, err)
-		return false
-	}
-	lastModifiedTime := fileInfo.ModTime().UTC()
-	return lastModifiedTime.After(markTime)
+// machineNameOf returns the name of the machine of the given node.
+func machineNameOf(node corev1.Node) string {
+	return cmp.Or(node.Labels[LabelMachineName], node.Name)
 }
 
-func (d *DriverImpl) watchSimulationConfig() {
-	for {
-		select {
-		case <-time.After(time.Second * 10):
-			if hasSimulationConfigChanged(d.lastSimConfigChange) {
-				err := d.refreshSimulationConfig()
-				if err != nil {
-					klog.Errorf("watchSimulationConfig cannot refreshSimulationConfig: %w", err)
-				}
-			}
-		}
+// initializeDelay returns the random delay after which the simulated cloud-controller-manager initializes a node.
+func (s SimulationConfig) initializeDelay() time.Duration {
+	if s.InstanceDelays.InitializeMax <= 0 {
+		return 0
 	}
+	return randomDuration(s.InstanceDelays.InitializeMin, s.InstanceDelays.InitializeMax)
 }
 
-func (d *DriverImpl) refreshSimulationConfig() error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	data, err := os.ReadFile(SimulationConfigPath)
-	if err != nil {
-		return err
+// simulateDuplicateInstance reports whether a duplicate instance should be created as per the SimulationConfig.
+func (s SimulationConfig) simulateDuplicateInstance() bool {
+	duplicate := rand.Float64() < s.DuplicateInstanceProbability
+	if duplicate {
+		klog.Warningf("Simulating creation of a duplicate instance")
 	}
-	var sm SimulationConfig
-	err = json.Unmarshal(data, &sm)
-	if err != nil {
-		return err
-	}
-	d.simConfig = sm
-	d.lastSimConfigChange = time.Now().UTC()
-	klog.Infof("refreshSimulationConfig reloaded %q at %q, simConfig=%v", SimulationConfigPath, d.lastSimConfigChange, d.simConfig)
-	return nil
+	return duplicate
 }
 
+// countNodesForRegionAndMachineType returns the number of existing instances of the given machine type in the given
+// region. Like in AWS, shutting down and terminated instances do not count against the quota.
 func (d *DriverImpl) countNodesForRegionAndMachineType(region, machineType string) (count int) {
 	for _, n := range d.managedNodes {
+		if !instanceExists(instanceStateOf(n)) {
+			continue
+		}
+		n = initialized(n)
 		if n.Labels[corev1.LabelTopologyRegion] == region && n.Labels[corev1.LabelInstanceTypeStable] == machineType {
 			count++
 		}
@@ -248,9 +307,48 @@ func (d *DriverImpl) CreateMachine(ctx context.Context, req *driver.CreateMachin
 		err = status.Error(codes.InvalidArgument, err.Error())
 		return
 	}
+	providerSpec, err := awsfake.DecodeProviderSpecAndSecret(req.MachineClass)
+	if err != nil {
+		return
+	}
+	err = d.checkCredentials(req.Secret)
+	if err != nil {
+		klog.Errorf("Credentials check of MachineClass %q failed: %v", req.MachineClass.Name, err)
+		return
+	}
+	if validationErr := awsfake.ValidateAWSProviderSpec(providerSpec, field.NewPath("providerSpec")).ToAggregate(); validationErr != nil {
+		err = status.Error(codes.InvalidArgument, fmt.Sprintf("Error while validating ProviderSpec %v", validationErr.Error()))
+		klog.Errorf("Validation of MachineClass %q failed: %v", req.MachineClass.Name, err)
+		return
+	}
+	simConfig := d.simConfig.For(overrideTargetOf(req.Machine, req.MachineClass.Name, providerSpec.MachineType))
+	existingNode, exists := d.nodeForMachine(req.Machine.Name)
+	// like the AWS provider, only pending, running, stopping or stopped instances are returned as existing.
+	if exists && instanceExists(instanceStateOf(existingNode)) && !simConfig.simulateDuplicateInstance() {
+		klog.Infof("Instance %q of machine %q already exists - returning it", existingNode.Spec.ProviderID, req.Machine.Name)
+		resp = &driver.CreateMachineResponse{
+			ProviderID:     initialized(existingNode).Spec.ProviderID,
+			NodeName:       existingNode.Name,
+			LastKnownState: fmt.Sprintf("Instance %q already exists", existingNode.Name),
+		}
+		return
+	}
+	nodeTemplate, err := d.instanceTypes.ResolveNodeTemplate(req.MachineClass)
+	if err != nil {
+		err = status.Error(codes.InvalidArgument, err.Error())
+		return
+	}
+	ephemeralStorage, ok, err := rootEphemeralStorage(providerSpec)
+	if err != nil {
+		err = status.Error(codes.InvalidArgument, err.Error())
+		return
+	}
+	if ok {
+		nodeTemplate.Capacity[corev1.ResourceEphemeralStorage] = ephemeralStorage
+	}
 	var refQuota *Quota
 	for _, q := range d.simConfig.Quotas {
-		if req.MachineClass.NodeTemplate.Region == q.Region && req.MachineClass.NodeTemplate.InstanceType == q.MachineType {
+		if nodeTemplate.Region == q.Region && nodeTemplate.InstanceType == q.MachineType {
 			refQuota = &q
 		}
 	}
@@ -263,7 +361,26 @@ func (d *DriverImpl) CreateMachine(ctx context.Context, req *driver.CreateMachin
 			return
 		}
 	}
-	node, err := newNode(req.Machine, req.MachineClass)
+	spotConfig := simConfig.spotConfigFor(providerSpec)
+	if spotConfig.simulateInsufficientCapacity() {
+		msg := insufficientCapacityMessage(nodeTemplate.InstanceType, nodeTemplate.Zone)
+		klog.Error(msg)
+		err = status.Error(codes.ResourceExhausted, msg)
+		return
+	}
+	kubeletUserData, err := ParseKubeletUserData(req.Secret.Data[awsfake.UserData])
+	if err != nil {
+		// the kubelet of a real instance would fail to start, the instance is still created though.
+		klog.Errorf("Cannot parse kubelet settings from userData of MachineClass %q - ignoring: %v", req.MachineClass.Name, err)
+		kubeletUserData = KubeletUserData{}
+	}
+	poolName := cmp.Or(req.Machine.Spec.NodeTemplateSpec.Labels[LabelWorkerPool], kubeletUserData.NodeLabels[LabelWorkerPool])
+	node, err := newNode(req.Machine, nodeTemplate, d.instanceTypes[nodeTemplate.InstanceType], kubeletUserData.Overlay(d.kubeletConfig.ForPool(poolName)), kubeletUserData)
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	node.Status.NodeInfo, err = d.machineImages.NodeSystemInfo(providerSpec.AMI, node.Labels[corev1.LabelArchStable], d.kubeletConfig.VersionForPool(poolName))
 	if err != nil {
 		err = status.Error(codes.Internal, err.Error())
 		return
@@ -273,170 +390,373 @@ func (d *DriverImpl) CreateMachine(ctx context.Context, req *driver.CreateMachin
 		err = status.Error(codes.Internal, err.Error())
 		return
 	}
-	node.Spec.ProviderID = awsfake.EncodeInstanceID(req.MachineClass.NodeTemplate.Region, instanceID)
+	node.Spec.ProviderID = awsfake.EncodeInstanceID(nodeTemplate.Region, instanceID)
+	subnet := d.simConfig.Network.SubnetFor(providerSpec, nodeTemplate.Zone)
+	err = assignNodeNetwork(&node, subnet, d.simConfig.Network, nodeTemplate.Region, d.managedNodes)
+	if errors.Is(err, ErrInsufficientFreeAddresses) {
+		klog.Error(err)
+		err = status.Error(codes.ResourceExhausted, err.Error())
+		return
+	} else if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	if d.simConfig.NodeNaming == NodeNamingPrivateDNSName {
+		privateDNSName := PrivateDNSName(netip.MustParseAddr(nodeInternalIP(node)), nodeTemplate.Region)
+		node.Name = privateDNSName
+		node.Labels[corev1.LabelHostname] = privateDNSName
+	}
+	if exists && node.Name == existingNode.Name {
+		node.Name = node.Name + "-" + instanceID
+		node.Labels[corev1.LabelHostname] = node.Name
+	}
+	err = setInstanceTags(&node, instanceTags(providerSpec, req.Machine.Name, req.MachineClass.Name))
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	if md := machineDeploymentOf(req.Machine); md != "" {
+		node.Annotations[AnnotationMachineDeployment] = md
+	}
+	providerID := node.Spec.ProviderID
+	startupTaints := simConfig.GetStartupTaints()
+	if d.simConfig.CloudControllerManager.Enabled {
+		err = registerBare(&node, time.Now().Add(simConfig.initializeDelay()))
+		if err != nil {
+			err = status.Error(codes.Internal, err.Error())
+			return
+		}
+		// the uninitialized taint is removed by the simulated cloud-controller-manager
+		startupTaints = slices.DeleteFunc(slices.Clone(startupTaints), func(s StartupTaint) bool {
+			return s.Key == TaintExternalCloudProvider
+		})
+	}
+	addStartupTaints(&node, startupTaints)
 	node.Status.Conditions = BuildReadyConditions(corev1.ConditionFalse)
 	node.Status.Phase = corev1.NodePending
-	delay := randomDuration(d.simConfig.InstanceDelays.CreateMin, d.simConfig.InstanceDelays.CreateMax)
+	delay := randomDuration(simConfig.InstanceDelays.CreateMin, simConfig.InstanceDelays.CreateMax)
 	klog.Infof("Simulating a delay in creation of %s for %q", delay, req.Machine.Name)
 	<-time.After(delay)
+	resp = &driver.CreateMachineResponse{
+		ProviderID:     providerID,
+		NodeName:       node.Name,
+		LastKnownState: fmt.Sprintf("Instance %q created at %q", node.Name, time.Now()),
+	}
+	joinFailureMode := simConfig.joinFailureMode(req.MachineClass.Name, nodeTemplate.Zone)
+	// the instance is pending until its kubelet joins, unless the kubelet fails after the instance is running.
+	node.Annotations[AnnotationInstanceState] = string(InstanceStatePending)
+	if joinFailureMode != "" {
+		node.Annotations[AnnotationInstanceState] = string(InstanceStateRunning)
+	}
+	if joinFailureMode == JoinFailureNoNode {
+		d.unjoinedInstances[node.Name] = node
+		d.managedNodes[node.Name] = node
+		klog.Infof("Created instance %q whose node %q never registers", providerID, node.Name)
+		return
+	}
+	if joinFailureMode == JoinFailureNotReady {
+		node.Annotations[AnnotationJoinFailure] = JoinFailureNotReady
+	}
 	_, err = d.client.CoreV1().Nodes().Create(ctx, &node, metav1.CreateOptions{})
 	if err != nil {
+		resp = nil
 		err = status.Error(codes.Internal, err.Error())
 		return
 	}
 	klog.Infof("Created NotReady node %q", node.Name)
-	resp = &driver.CreateMachineResponse{
-		ProviderID:     node.Spec.ProviderID,
-		NodeName:       node.Name,
-		LastKnownState: fmt.Sprintf("Instance %q created at %q", node.Name, time.Now()),
+	if joinFailureMode == JoinFailureNotReady {
+		err = d.reloadNodes(ctx)
+		return
 	}
 
-	joinDelay := randomDuration(d.simConfig.InstanceDelays.JoinMin, d.simConfig.InstanceDelays.JoinMax)
+	if interruptionDelay, ok := spotConfig.interruptionDelay(); ok {
+		d.scheduleSpotInterruption(node.Name, interruptionDelay)
+	}
+	joinDelay := randomDuration(simConfig.InstanceDelays.JoinMin, simConfig.InstanceDelays.JoinMax)
 	go func() {
 		klog.Infof("Waiting for joinDelay %q before making node %q Ready", joinDelay, node.Name)
 		<-time.After(joinDelay)
-		_, err = makeNodeReady(d.client, node.Name)
-		if err != nil {
-			klog.Errorf("Failed to make node %q Ready: %v", node.Name, err)
-		}
-		err = d.reloadNodes(ctx)
-		if err != nil {
-			klog.Error("Failed to reload nodes", err)
-		}
-		d.changeAssignedPodsToRunning(ctx) //TODO: Introduce SimulationConfig.PodReadyMinDelay, PodReadyMaxDelay
+		d.completeJoin(context.Background(), node.Name, startupTaints)
 	}()
 	err = d.reloadNodes(ctx)
 	klog.Infof("Driver.CreateMachine ended.")
 	return
 }
 
-// randomDuration returns a random duration between min  and max (inclusive).
+// completeJoin marks the pending instance of the given node running and makes its node Ready once its kubelet joined.
+// Instances deleted or stopped in the meantime are left alone.
+func (d *DriverImpl) completeJoin(ctx context.Context, nodeName string, startupTaints []StartupTaint) {
+	d.mu.Lock()
+	pending, err := markInstanceRunning(ctx, d.client, nodeName)
+	d.mu.Unlock()
+	if err != nil {
+		klog.Errorf("Failed to mark instance of node %q running: %v", nodeName, err)
+		return
+	}
+	if !pending {
+		klog.Infof("Instance of node %q is no longer pending - not making its node Ready", nodeName)
+		return
+	}
+	_, err = makeNodeReady(d.client, nodeName)
+	if err != nil {
+		klog.Errorf("Failed to make node %q Ready: %v", nodeName, err)
+	} else {
+		scheduleStartupTaintRemoval(d.client, nodeName, startupTaints)
+	}
+	d.mu.Lock()
+	err = d.reloadNodes(ctx)
+	d.mu.Unlock()
+	if err != nil {
+		klog.Error("Failed to reload nodes", err)
+	}
+	d.changeAssignedPodsToRunning(ctx) //TODO: Introduce SimulationConfig.PodReadyMinDelay, PodReadyMaxDelay
+}
+
+// markInstanceRunning moves the instance of the given node from pending to running and reports whether it was
+// pending.
+func markInstanceRunning(ctx context.Context, client kubernetes.Interface, nodeName string) (pending bool, err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		pending = instanceStateOf(*node) == InstanceStatePending
+		if !pending {
+			return nil
+		}
+		node.Annotations[AnnotationInstanceState] = string(InstanceStateRunning)
+		_, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+	return
+}
+
+// randomDuration returns a random duration between min and max (inclusive), or min if max does not exceed it.
 func randomDuration(minSecs, maxSecs int64) time.Duration {
-	minNano := time.Second.Nanoseconds() * minSecs
+	minNano := time.Second.Nanoseconds() * max(minSecs, 0)
 	maxNano := time.Second.Nanoseconds() * maxSecs
-	return time.Duration(rand.Int64N(maxNano) + minNano)
+	if maxNano <= minNano {
+		return time.Duration(minNano)
+	}
+	return time.Duration(minNano + rand.Int64N(maxNano-minNano+1))
 }
 
-func makeNodeReady(client *kubernetes.Clientset, nodeName string) (adjustedNode corev1.Node, err error) {
-	node, err := client.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
-	if err != nil {
-		err = fmt.Errorf("adjustNode cannot get node with name %q: %w", node.Name, err)
-		return
-	}
-	node.Spec.Taints = slices.DeleteFunc(node.Spec.Taints, func(taint corev1.Taint) bool {
-		return taint.Key == "node.kubernetes.io/not-ready"
+// makeNodeReady removes the not-ready taint of the node and makes it Ready, retrying on conflicts with the other
+// simulated controllers updating the node.
+func makeNodeReady(client kubernetes.Interface, nodeName string) (adjustedNode corev1.Node, err error) {
+	ctx := context.Background()
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("makeNodeReady cannot get node with name %q: %w", nodeName, err)
+		}
+		node.Spec.Taints = slices.DeleteFunc(node.Spec.Taints, func(taint corev1.Taint) bool {
+			return taint.Key == "node.kubernetes.io/not-ready"
+		})
+		nd, err := client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("makeNodeReady cannot update node with name %q: %w", nodeName, err)
+		}
+		nd.Status.Phase = corev1.NodeRunning
+		nd.Status.Conditions = BuildReadyConditions(corev1.ConditionTrue)
+		nd, err = client.CoreV1().Nodes().UpdateStatus(ctx, nd, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("makeNodeReady cannot update the status of node with name %q: %w", nodeName, err)
+		}
+		adjustedNode = *nd.DeepCopy()
+		return nil
 	})
-	//nd.Spec.Taints = lo.Filter(nd.Spec.Taints, func(item corev1.Taint, index int) bool {
-	//	return item.Key != "node.kubernetes.io/not-ready"
-	//})
-	nd, err := client.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
 	if err != nil {
-		err = fmt.Errorf("makeNodeReady cannot update node with name %q: %w", nd.Name, err)
 		return
 	}
-	nd.Status.Phase = corev1.NodeRunning
-	nd.Status.Conditions = BuildReadyConditions(corev1.ConditionTrue)
-	nd, err = client.CoreV1().Nodes().UpdateStatus(context.Background(), nd, metav1.UpdateOptions{})
-	if err != nil {
-		err = fmt.Errorf("makeNodeReady cannot update the status of node with name %q: %w", nd.Name, err)
-	}
-	adjustedNode = *nd.DeepCopy()
-	klog.Infof("makeNodeReady made node %q Ready", nd.Name)
+	klog.Infof("makeNodeReady made node %q Ready", nodeName)
 	return
 }
 
-func newNode(machine *v1alpha1.Machine, machineClass *v1alpha1.MachineClass) (node corev1.Node, err error) {
-	//providerSpec, err := awsfake.DecodeProviderSpecAndSecret(machineClass)
-	//if err != nil {
-	//	return
-	//}
-	nodeName := machine.Name // not really accurate with AWS but easier
+// newNode creates the Node for the given Machine with its capacity taken from the given resolved NodeTemplate and its
+// allocatable computed from the given kubelet reservation. The instance type is used to map GPUs to the extended
+// resources of their device plugins and may be empty if not present in the catalog.
+func newNode(machine *v1alpha1.Machine, nodeTemplate v1alpha1.NodeTemplate, instanceType InstanceType, reservation KubeletReservation, kubeletUserData KubeletUserData) (node corev1.Node, err error) {
+	nodeName := machine.Name // renamed to the private DNS name as per the SimulationConfig NodeNaming
 	node.ObjectMeta = metav1.ObjectMeta{
 		Name:   nodeName,
 		Labels: map[string]string{},
 	}
 	node.Status = corev1.NodeStatus{
-		Capacity: maps.Clone(machineClass.NodeTemplate.Capacity),
+		Capacity: maps.Clone(nodeTemplate.Capacity),
+	}
+	if _, ok := node.Status.Capacity[corev1.ResourcePods]; !ok {
+		node.Status.Capacity[corev1.ResourcePods] = *resource.NewQuantity(DefaultMaxPods, resource.DecimalSI)
+	}
+	if _, ok := node.Status.Capacity[corev1.ResourceEphemeralStorage]; !ok {
+		node.Status.Capacity[corev1.ResourceEphemeralStorage] = resource.MustParse(DefaultEphemeralStorageCapacity)
 	}
-	node.Status.Capacity[corev1.ResourcePods] = resource.MustParse("110")                    // very sucky
-	node.Status.Capacity["nvidia.com/gpu"] = machineClass.NodeTemplate.Capacity["gpu"]       // TODO: weird - does not come in node.status.capacity nor allocatable
-	node.Status.Capacity[corev1.ResourceEphemeralStorage] = resource.MustParse("50225972Ki") // hard-coding
 	node.Status.Capacity["hugepages-1Gi"] = *resource.NewQuantity(0, resource.DecimalSI)
 	node.Status.Capacity["hugepages-2Mi"] = *resource.NewQuantity(0, resource.DecimalSI)
 
-	node.Status.Allocatable = maps.Clone(node.Status.Capacity)
-	node.Status.Allocatable[corev1.ResourceEphemeralStorage] = resource.MustParse("48859825524") // hard-coding
-	mem := node.Status.Capacity[corev1.ResourceMemory].DeepCopy()
-
-	// subtracting 1.65 GB which includes 1Gb for kube reserved.
-	subMem, err := resource.ParseQuantity("1.65Gi")
-	if err != nil {
-		return
-	}
-	allocatableMem := &mem
-	allocatableMem.Sub(subMem)
-	node.Status.Allocatable[corev1.ResourceMemory] = *allocatableMem
-
 	if len(node.Annotations) == 0 {
 		node.Annotations = make(map[string]string)
 	}
+	arch := DefaultArchitecture
+	if nodeTemplate.Architecture != nil {
+		arch = *nodeTemplate.Architecture
+	}
 	node.Annotations["volumes.kubernetes.io/controller-managed-attach-detach"] = "true"
-	node.Labels[corev1.LabelArchStable] = *machineClass.NodeTemplate.Architecture
+	node.Labels[corev1.LabelArchStable] = arch
 	node.Labels[corev1.LabelHostname] = nodeName
 	node.Labels[corev1.LabelOSStable] = "linux"
-	node.Labels[corev1.LabelInstanceType] = machineClass.NodeTemplate.InstanceType
-	node.Labels[corev1.LabelInstanceTypeStable] = machineClass.NodeTemplate.InstanceType
-	node.Labels["node.gardener.cloud/machine-name"] = machine.Name
+	node.Labels[corev1.LabelInstanceType] = nodeTemplate.InstanceType
+	node.Labels[corev1.LabelInstanceTypeStable] = nodeTemplate.InstanceType
+	node.Labels[LabelMachineName] = machine.Name
 	node.Labels["networking.gardener.cloud/node-local-dns-enabled"] = "true"
-	node.Labels[corev1.LabelTopologyRegion] = machineClass.NodeTemplate.Region
-	node.Labels[corev1.LabelInstanceType] = machineClass.NodeTemplate.InstanceType
+	node.Labels[corev1.LabelTopologyRegion] = nodeTemplate.Region
+	if nodeTemplate.Zone != "" {
+		node.Labels[corev1.LabelTopologyZone] = nodeTemplate.Zone
+	}
 
-	for k, v := range machine.Spec.NodeTemplateSpec.Labels {
-		node.Labels[k] = v
+	kubeletUserData.Apply(&node)
+	applyNodeTemplateSpec(&node, machine)
+	err = applyExtendedResources(&node, nodeTemplate, instanceType)
+	if err != nil {
+		return
+	}
+	node.Status.Allocatable, err = reservation.ComputeAllocatable(node.Status.Capacity)
+	if err != nil {
+		err = fmt.Errorf("cannot compute allocatable for node %q: %w", nodeName, err)
+		return
 	}
 	return
 
 }
 
-func (d *DriverImpl) InitializeMachine(ctx context.Context, request *driver.InitializeMachineRequest) (*driver.InitializeMachineResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "Virtual Provider does not yet implement InitializeMachine")
+func (d *DriverImpl) InitializeMachine(ctx context.Context, request *driver.InitializeMachineRequest) (response *driver.InitializeMachineResponse, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.checkCredentials(request.Secret)
+	if err != nil {
+		return
+	}
+	node, ok := d.nodeForMachine(request.Machine.Name)
+	if !ok || !instanceExists(instanceStateOf(node)) {
+		err = status.Error(codes.NotFound, fmt.Sprintf("instance of machine %q not found", request.Machine.Name))
+		return
+	}
+	node, err = d.updateInstanceAnnotations(ctx, node.Name, map[string]string{AnnotationInstanceInitialized: "true"})
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	node = initialized(node)
+	response = &driver.InitializeMachineResponse{
+		ProviderID: node.Spec.ProviderID,
+		NodeName:   node.Name,
+		Addresses:  node.Status.Addresses,
+	}
+	klog.Infof("Initialized instance %q of machine %q", node.Spec.ProviderID, request.Machine.Name)
+	return
 }
 
 func (d *DriverImpl) DeleteMachine(ctx context.Context, request *driver.DeleteMachineRequest) (response *driver.DeleteMachineResponse, err error) {
 	d.mu.Lock()
-	delay := randomDuration(d.simConfig.InstanceDelays.DeleteMin, d.simConfig.InstanceDelays.DeleteMax)
-	klog.Infof("Simulating a delay in deletion of %s for %q", delay, request.Machine.Name)
-	defer func() {
-		<-time.After(delay)
-	}()
 	defer d.mu.Unlock()
-	delete(d.managedNodes, request.Machine.Name)
+	err = d.checkCredentials(request.Secret)
+	if err != nil {
+		return
+	}
+	node, ok := d.nodeForMachine(request.Machine.Name)
+	if !ok || instanceStateOf(node) == InstanceStateTerminated {
+		err = status.Error(codes.NotFound, fmt.Sprintf("instance of machine %q not found", request.Machine.Name))
+		return
+	}
+	response = &driver.DeleteMachineResponse{
+		LastKnownState: fmt.Sprintf("Instance %q is %s", node.Spec.ProviderID, InstanceStateShuttingDown),
+	}
+	if instanceStateOf(node) == InstanceStateShuttingDown {
+		klog.Infof("Instance %q of machine %q is already shutting down", node.Spec.ProviderID, request.Machine.Name)
+		return
+	}
+	simConfig := d.simConfig.For(nodeOverrideTarget(node))
+	stuck := rand.Float64() < simConfig.StuckTerminationProbability
+	if _, ok := d.unjoinedInstances[node.Name]; ok {
+		node, err = d.updateInstanceAnnotations(ctx, node.Name, map[string]string{AnnotationInstanceState: string(InstanceStateShuttingDown)})
+	} else {
+		node, err = setInstanceState(ctx, d.client, node.Name, InstanceStateShuttingDown, stuck)
+	}
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	d.managedNodes[node.Name] = node
+	if stuck {
+		klog.Warningf("Simulating stuck termination of instance %q of machine %q", node.Spec.ProviderID, request.Machine.Name)
+		return
+	}
+	d.scheduleTermination(node.Name, randomDuration(simConfig.InstanceDelays.DeleteMin, simConfig.InstanceDelays.DeleteMax))
 	return
 }
 
+// GetMachineStatus reports the state of the instance of the machine. Pending instances and instances not yet
+// initialized via InitializeMachine yield codes.Uninitialized, stopping and stopped instances codes.Unavailable and
+// shutting-down, terminated and unknown instances codes.NotFound. The response is set for existing instances even if
+// an error is returned, as MCM reads it for uninitialized instances.
 func (d *DriverImpl) GetMachineStatus(ctx context.Context, request *driver.GetMachineStatusRequest) (response *driver.GetMachineStatusResponse, err error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	// TODO: introduce simulation of failures here.
-	node, ok := d.managedNodes[request.Machine.Name]
+	err = d.checkCredentials(request.Secret)
+	if err != nil {
+		return
+	}
+	node, ok := d.nodeForMachine(request.Machine.Name)
 	if !ok {
-		err = status.Error(codes.NotFound, fmt.Sprintf("instance %q not found", request.Machine.Name))
+		err = status.Error(codes.NotFound, fmt.Sprintf("instance of machine %q not found", request.Machine.Name))
+		return
+	}
+	node = initialized(node)
+	state := instanceStateOf(node)
+	msg := fmt.Sprintf("instance %q of machine %q is %s", node.Spec.ProviderID, request.Machine.Name, state)
+	if !instanceExists(state) {
+		err = status.Error(codes.NotFound, msg)
 		return
 	}
 	response = &driver.GetMachineStatusResponse{
 		NodeName:   node.Name,
 		ProviderID: node.Spec.ProviderID,
+		Addresses:  node.Status.Addresses,
+	}
+	switch {
+	case state == InstanceStatePending:
+		err = status.Error(codes.Uninitialized, msg)
+	case state == InstanceStateStopping || state == InstanceStateStopped:
+		err = status.Error(codes.Unavailable, msg)
+	case node.Annotations[AnnotationInstanceInitialized] != "true":
+		err = status.Error(codes.Uninitialized, fmt.Sprintf("instance %q of machine %q is initializing", node.Spec.ProviderID, request.Machine.Name))
 	}
-	go d.changeAssignedPodsToRunning(ctx)
 	return
 }
 
 func (d *DriverImpl) ListMachines(ctx context.Context, request *driver.ListMachinesRequest) (response *driver.ListMachinesResponse, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.checkCredentials(request.Secret)
+	if err != nil {
+		return
+	}
+	providerSpec, err := awsfake.DecodeProviderSpecAndSecret(request.MachineClass)
+	if err != nil {
+		return
+	}
 	response = &driver.ListMachinesResponse{
 		MachineList: make(map[string]string),
 	}
 	for _, node := range d.managedNodes {
-		response.MachineList[node.Spec.ProviderID] = node.Name
+		if !ownedBy(node, providerSpec, request.MachineClass.Name) {
+			continue
+		}
+		// like the AWS provider, only instances which are pending, running, stopping or stopped are listed.
+		if !instanceExists(instanceStateOf(node)) {
+			continue
+		}
+		response.MachineList[initialized(node).Spec.ProviderID] = machineNameOf(node)
 	}
 	go d.changeAssignedPodsToRunning(ctx)
 	return
@@ -451,6 +771,22 @@ func (d *DriverImpl) changeAssignedPodsToRunning(ctx context.Context) {
 	pods, err := d.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
 	if err != nil {
 		klog.Errorf("changeAssignedPodsToRunning failed to list pods due to %v", err)
+		return
+	}
+	d.mu.Lock()
+	nodes := maps.Clone(d.managedNodes)
+	d.mu.Unlock()
+	usedPodIPs := make(map[string]map[netip.Addr]bool)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Spec.HostNetwork {
+			continue
+		}
+		if usedPodIPs[pod.Spec.NodeName] == nil {
+			usedPodIPs[pod.Spec.NodeName] = make(map[netip.Addr]bool)
+		}
+		if ip, err := netip.ParseAddr(pod.Status.PodIP); err == nil {
+			usedPodIPs[pod.Spec.NodeName][ip] = true
+		}
 	}
 	// Iterate over the pods and patch those in "Pending" status
 	for _, pod := range pods.Items {
@@ -458,6 +794,13 @@ func (d *DriverImpl) changeAssignedPodsToRunning(ctx context.Context) {
 			// Example patch: add a label to trigger changes (as a simple trigger)
 			//podStatus := pod.Status.DeepCopy()
 			//podStatus.Phase = corev1.PodRunning
+			if node, ok := nodes[pod.Spec.NodeName]; ok {
+				err = assignPodIPs(&pod, node, usedPodIPs[pod.Spec.NodeName])
+				if err != nil {
+					klog.Errorf("changeAssignedPodsToRunning cannot assign IP to pod %q on node %q: %v", pod.Name, pod.Spec.NodeName, err)
+					continue
+				}
+			}
 			pod.Status.Phase = corev1.PodRunning
 			_, err = d.client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, &pod, metav1.UpdateOptions{})
 			if err != nil {
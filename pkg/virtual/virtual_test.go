@@ -0,0 +1,148 @@
+package virtual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeForMachine(t *testing.T) {
+	d := &DriverImpl{managedNodes: map[string]corev1.Node{
+		"shoot-worker-a-1": {ObjectMeta: metav1.ObjectMeta{Name: "shoot-worker-a-1", Labels: map[string]string{LabelMachineName: "shoot-worker-a-1"}}},
+		"ip-10-250-0-4.eu-west-1.compute.internal": {ObjectMeta: metav1.ObjectMeta{
+			Name:   "ip-10-250-0-4.eu-west-1.compute.internal",
+			Labels: map[string]string{LabelMachineName: "shoot-worker-a-2"},
+		}},
+		"shoot-worker-a-4": {ObjectMeta: metav1.ObjectMeta{
+			Name:        "shoot-worker-a-4",
+			Labels:      map[string]string{LabelMachineName: "shoot-worker-a-4"},
+			Annotations: map[string]string{AnnotationInstanceState: string(InstanceStateTerminated)},
+		}},
+		"shoot-worker-a-4-i-0123": {ObjectMeta: metav1.ObjectMeta{
+			Name:   "shoot-worker-a-4-i-0123",
+			Labels: map[string]string{LabelMachineName: "shoot-worker-a-4"},
+		}},
+		"shoot-worker-a-5": {ObjectMeta: metav1.ObjectMeta{
+			Name:        "shoot-worker-a-5",
+			Labels:      map[string]string{LabelMachineName: "shoot-worker-a-5"},
+			Annotations: map[string]string{AnnotationInstanceState: string(InstanceStateShuttingDown)},
+		}},
+		"shoot-worker-a-6": {ObjectMeta: metav1.ObjectMeta{
+			Name:              "shoot-worker-a-6",
+			Labels:            map[string]string{LabelMachineName: "shoot-worker-a-6"},
+			CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		}},
+		"shoot-worker-a-6-i-0456": {ObjectMeta: metav1.ObjectMeta{
+			Name:              "shoot-worker-a-6-i-0456",
+			Labels:            map[string]string{LabelMachineName: "shoot-worker-a-6"},
+			CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)),
+		}},
+	}}
+	tests := []struct {
+		machineName  string
+		wantNodeName string
+	}{
+		{"shoot-worker-a-1", "shoot-worker-a-1"},
+		{"shoot-worker-a-2", "ip-10-250-0-4.eu-west-1.compute.internal"},
+		{"shoot-worker-a-3", ""},
+		{"shoot-worker-a-4", "shoot-worker-a-4-i-0123"},
+		{"shoot-worker-a-5", "shoot-worker-a-5"},
+		{"shoot-worker-a-6", "shoot-worker-a-6-i-0456"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.machineName, func(t *testing.T) {
+			node, ok := d.nodeForMachine(tc.machineName)
+			if ok != (tc.wantNodeName != "") || node.Name != tc.wantNodeName {
+				t.Errorf("nodeForMachine(%q) = %q, %v, want %q", tc.machineName, node.Name, ok, tc.wantNodeName)
+			}
+		})
+	}
+}
+
+func TestCountNodesForRegionAndMachineType(t *testing.T) {
+	node := func(name string, state InstanceState) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{corev1.LabelTopologyRegion: "eu-west-1", corev1.LabelInstanceTypeStable: "m5.large"},
+			Annotations: map[string]string{AnnotationInstanceState: string(state)},
+		}}
+	}
+	d := &DriverImpl{managedNodes: map[string]corev1.Node{
+		"n1": node("n1", InstanceStateRunning),
+		"n2": node("n2", InstanceStateStopped),
+		"n3": node("n3", InstanceStateShuttingDown),
+		"n4": node("n4", InstanceStateTerminated),
+	}}
+	if got := d.countNodesForRegionAndMachineType("eu-west-1", "m5.large"); got != 2 {
+		t.Errorf("countNodesForRegionAndMachineType() = %d, want 2", got)
+	}
+}
+
+func TestSimulateDuplicateInstance(t *testing.T) {
+	for _, probability := range []float64{0, 1} {
+		d := &DriverImpl{simConfig: SimulationConfig{DuplicateInstanceProbability: probability}}
+		if got, want := d.simConfig.simulateDuplicateInstance(), probability == 1; got != want {
+			t.Errorf("simulateDuplicateInstance() with probability %v = %v, want %v", probability, got, want)
+		}
+	}
+}
+
+func TestMakeNodeReadyRetriesOnConflict(t *testing.T) {
+	client := fake.NewClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "n1"},
+		Spec:       corev1.NodeSpec{Taints: []corev1.Taint{{Key: "node.kubernetes.io/not-ready", Effect: corev1.TaintEffectNoSchedule}}},
+		Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionFalse)},
+	})
+	conflicts := 1
+	client.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(corev1.Resource("nodes"), "n1", nil)
+	})
+	if _, err := makeNodeReady(client, "n1"); err != nil {
+		t.Fatalf("makeNodeReady() err = %v", err)
+	}
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "n1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Spec.Taints) != 0 || !isNodeReady(*node) {
+		t.Errorf("expected node to be Ready without not-ready taint, got %+v", node)
+	}
+}
+
+func TestCompleteJoin(t *testing.T) {
+	ctx := context.Background()
+	newNode := func(name string, state InstanceState) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{AnnotationInstanceState: string(state)}},
+			Status:     corev1.NodeStatus{Conditions: BuildReadyConditions(corev1.ConditionFalse)},
+		}
+	}
+	client := fake.NewClientset(newNode("joining", InstanceStatePending), newNode("deleted", InstanceStateShuttingDown))
+	d := &DriverImpl{client: client, managedNodes: make(map[string]corev1.Node), unjoinedInstances: make(map[string]corev1.Node)}
+	d.completeJoin(ctx, "joining", nil)
+	d.completeJoin(ctx, "deleted", nil)
+
+	for name, want := range map[string]InstanceState{"joining": InstanceStateRunning, "deleted": InstanceStateShuttingDown} {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := instanceStateOf(*node); got != want {
+			t.Errorf("instance state of node %q = %q, want %q", name, got, want)
+		}
+		if isNodeReady(*node) != (want == InstanceStateRunning) {
+			t.Errorf("node %q Ready = %v, want %v", name, isNodeReady(*node), want == InstanceStateRunning)
+		}
+	}
+}